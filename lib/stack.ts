@@ -4,7 +4,6 @@ import * as iam from '@aws-cdk/aws-iam';
 import * as sns from '@aws-cdk/aws-sns';
 import * as sqs from '@aws-cdk/aws-sqs';
 import * as ec2 from '@aws-cdk/aws-ec2';
-import { SqsEventSource } from '@aws-cdk/aws-lambda-event-sources';
 import { SqsSubscription } from '@aws-cdk/aws-sns-subscriptions';
 
 import * as path from 'path';
@@ -21,7 +20,9 @@ export interface GitHubProps extends cdk.StackProps {
   reportTopic?: sns.ITopic;
   reportTopicARN?: string;
 
-  // A secret has `github_token`
+  // A secret has either one set of credentials:
+  // - GitHub App: `github_app_id`, `github_install_id` and `github_private_key` (base64 encoded)
+  // - Personal access token (classic or fine-grained): `github_token`
   secretARN: string;
 
   // github API endpoint, default is https://api.github.com
@@ -29,6 +30,35 @@ export interface GitHubProps extends cdk.StackProps {
   // github repository to upload report.
   // e.g.) 'm-mizutani/alert' for https://github.com/m-mizutani/alert
   githubRepo: string;
+  // Branch to store alert files. Default branch of the repository is used if not set.
+  // The branch is created from the default branch if it does not exist.
+  githubBranch?: string;
+  // Routing rules of reports as JSON array. A matched rule overrides githubRepo.
+  // e.g.) '[{"severity":"urgent","repo":"m-mizutani/oncall"},{"detector":"noisy","action":"drop"}]'
+  // Keys of a rule: severity, detector, rule_name, repo and action ("publish" or "drop")
+  githubRoutes?: string;
+  // Assignee, mention, milestone and project column rules of new issues as JSON array.
+  // e.g.) '[{"severity":"urgent","assignees":["oncall-user"],"mentions":["my-org/sec-team"],"project_column_id":1234}]'
+  // Keys of a rule: severity, detector, rule_name, assignees, mentions, milestone and project_column_id
+  githubAssignRules?: string;
+  // Comma separated JSON field paths masked in archived report.json and alert JSON files.
+  // A path matches also as suffix. e.g.) 'attributes.value,body.password'
+  archiveRedactFields?: string;
+  // text/template of issue title. Default is '[Detector] RuleName: Description (+N more)'
+  githubTitleTemplate?: string;
+  // text/template of issue body. Default layout is used if not set.
+  githubBodyTemplate?: string;
+  // File path of issue body template relative to root of this project. The file
+  // is bundled into the Lambda package. githubBodyTemplate is prior to the file.
+  githubBodyTemplateFile?: string;
+  // Render IP address, domain name and URL not to be clicked, e.g. hxxp://evil[.]com
+  // Original values are kept in a collapsed section of issue body and alert files.
+  githubDefang?: boolean;
+  // Quick-pivot links of attribute values as JSON map from attribute type to links. URL is text/template.
+  // e.g.) '{"ipaddr":[{"name":"Shodan","url":"https://www.shodan.io/host/{{ .Value | pathEscape }}"}]}'
+  githubEnrichLinks?: string;
+  // Log GitHub operations that would be done without calling GitHub API
+  dryRun?: boolean;
 
   // Optional properties
   vpcConfig?: vpcConfig;
@@ -72,7 +102,9 @@ export class GitHubStack extends cdk.Stack {
       bundling: {
         image: lambda.Runtime.GO_1_X.bundlingDockerImage,
         user: 'root',
-        command: ['go', 'build', '-o', '/asset-output/emitter', './src'],
+        command: props.githubBodyTemplateFile
+          ? ['bash', '-c', `go build -o /asset-output/emitter ./src && cp ${props.githubBodyTemplateFile} /asset-output/body.tmpl`]
+          : ['go', 'build', '-o', '/asset-output/emitter', './src'],
         environment: {
           GOARCH: 'amd64',
           GOOS: 'linux',
@@ -114,7 +146,6 @@ export class GitHubStack extends cdk.Stack {
       handler: 'emitter',
       code: asset,
       role: lambdaRole,
-      events: [new SqsEventSource(reportQueue)],
       timeout: taskQueueTimeout,
 
       vpc,
@@ -125,11 +156,31 @@ export class GitHubStack extends cdk.Stack {
         SECRET_ARN: props.secretARN,
         GITHUB_ENDPOINT: props.githubEndpoint || '',
         GITHUB_REPO: props.githubRepo,
+        GITHUB_BRANCH: props.githubBranch || '',
+        GITHUB_ROUTES: props.githubRoutes || '',
+        GITHUB_ASSIGN_RULES: props.githubAssignRules || '',
+        ARCHIVE_REDACT_FIELDS: props.archiveRedactFields || '',
+        GITHUB_TITLE_TEMPLATE: props.githubTitleTemplate || '',
+        GITHUB_BODY_TEMPLATE: props.githubBodyTemplate || '',
+        GITHUB_BODY_TEMPLATE_FILE: props.githubBodyTemplateFile ? '/var/task/body.tmpl' : '',
+        GITHUB_DEFANG: props.githubDefang ? 'true' : 'false',
+        GITHUB_ENRICH_LINKS: props.githubEnrichLinks || '',
+        DRY_RUN: props.dryRun ? 'true' : 'false',
 
         SENTRY_DSN: props.sentryDsn || "",
         SENTRY_ENVIRONMENT: props.sentryEnv || "",
         LOG_LEVEL: props.logLevel || "",
       },
     });
+
+    // The emitter returns failed message IDs as batchItemFailures so that only
+    // failed messages go back to the queue.
+    reportQueue.grantConsumeMessages(this.emitter);
+    const eventSource = new lambda.EventSourceMapping(this, 'reportQueueEventSource', {
+      target: this.emitter,
+      eventSourceArn: reportQueue.queueArn,
+    });
+    const cfnEventSource = eventSource.node.defaultChild as lambda.CfnEventSourceMapping;
+    cfnEventSource.addPropertyOverride('FunctionResponseTypes', ['ReportBatchItemFailures']);
   }
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/deepalert/deepalert"
+	"github.com/google/go-github/v27/github"
+	"github.com/m-mizutani/golambda"
+)
+
+// githubAPI is GitHub operations to publish alert files and issues of a
+// report. githubClient calls actual GitHub API.
+type githubAPI interface {
+	// Alert archive
+	resolveBranch(ctx context.Context, owner, repo, configured string) (string, error)
+	readFile(ctx context.Context, owner, repo, ref, filePath string) ([]byte, error)
+	commitFiles(ctx context.Context, owner, repo, branch, message string, build archiveBuilder) (string, error)
+
+	// Issue
+	findIssue(ctx context.Context, repos []string, reportID deepalert.ReportID) (*github.Issue, error)
+	createIssue(ctx context.Context, owner, repo string, req *github.IssueRequest) (*github.Issue, error)
+	editIssue(ctx context.Context, owner, repo string, number int, req *github.IssueRequest) (*github.Issue, error)
+	createComment(ctx context.Context, owner, repo string, number int, body string) error
+	ensureLabels(ctx context.Context, owner, repo string, labels []string) error
+	addLabels(ctx context.Context, owner, repo string, number int, labels []string) error
+	removeLabel(ctx context.Context, owner, repo string, number int, label string) error
+	validAssignees(ctx context.Context, owner, repo string, assignees []string) []string
+	addProjectCard(ctx context.Context, columnID int64, issue *github.Issue)
+}
+
+// githubClient is githubAPI with go-github client
+type githubClient struct {
+	client *github.Client
+}
+
+func (x *githubClient) resolveBranch(ctx context.Context, owner, repo, configured string) (string, error) {
+	return resolveBranch(ctx, x.client, owner, repo, configured)
+}
+
+func (x *githubClient) readFile(ctx context.Context, owner, repo, ref, filePath string) ([]byte, error) {
+	return readArchiveFile(ctx, x.client, owner, repo, ref, filePath)
+}
+
+func (x *githubClient) commitFiles(ctx context.Context, owner, repo, branch, message string, build archiveBuilder) (string, error) {
+	return commitFiles(ctx, x.client, owner, repo, branch, message, build)
+}
+
+func (x *githubClient) findIssue(ctx context.Context, repos []string, reportID deepalert.ReportID) (*github.Issue, error) {
+	return findIssue(ctx, x.client, repos, reportID)
+}
+
+func (x *githubClient) createIssue(ctx context.Context, owner, repo string, req *github.IssueRequest) (*github.Issue, error) {
+	issue, resp, err := x.client.Issues.Create(ctx, owner, repo, req)
+	if err != nil {
+		return nil, wrapGithubError(err, "Failed to create an issue", resp).
+			With("owner", owner).
+			With("repo", repo)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, golambda.NewError("Fail to create issue because response code is not 201").With("code", resp.StatusCode)
+	}
+
+	return issue, nil
+}
+
+func (x *githubClient) editIssue(ctx context.Context, owner, repo string, number int, req *github.IssueRequest) (*github.Issue, error) {
+	issue, resp, err := x.client.Issues.Edit(ctx, owner, repo, number, req)
+	if err != nil {
+		return nil, wrapGithubError(err, "Failed to update an issue", resp).
+			With("owner", owner).
+			With("repo", repo).
+			With("number", number)
+	}
+	return issue, nil
+}
+
+func (x *githubClient) createComment(ctx context.Context, owner, repo string, number int, body string) error {
+	comment := &github.IssueComment{Body: github.String(body)}
+	if _, resp, err := x.client.Issues.CreateComment(ctx, owner, repo, number, comment); err != nil {
+		return wrapGithubError(err, "Failed to comment to an issue", resp).
+			With("owner", owner).
+			With("repo", repo).
+			With("number", number)
+	}
+	return nil
+}
+
+func (x *githubClient) ensureLabels(ctx context.Context, owner, repo string, labels []string) error {
+	return ensureLabels(ctx, x.client, owner, repo, labels)
+}
+
+func (x *githubClient) addLabels(ctx context.Context, owner, repo string, number int, labels []string) error {
+	if _, resp, err := x.client.Issues.AddLabelsToIssue(ctx, owner, repo, number, labels); err != nil {
+		return wrapGithubError(err, "Failed to add labels to an issue", resp).
+			With("owner", owner).
+			With("repo", repo).
+			With("number", number)
+	}
+	return nil
+}
+
+func (x *githubClient) removeLabel(ctx context.Context, owner, repo string, number int, label string) error {
+	resp, err := x.client.Issues.RemoveLabelForIssue(ctx, owner, repo, number, label)
+	if err != nil {
+		// Label is already removed
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return wrapGithubError(err, "Failed to remove a label from an issue", resp).
+			With("owner", owner).
+			With("repo", repo).
+			With("number", number).
+			With("label", label)
+	}
+	return nil
+}
+
+func (x *githubClient) validAssignees(ctx context.Context, owner, repo string, assignees []string) []string {
+	return validAssignees(ctx, x.client, owner, repo, assignees)
+}
+
+func (x *githubClient) addProjectCard(ctx context.Context, columnID int64, issue *github.Issue) {
+	addProjectCard(ctx, x.client, columnID, issue)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/deepalert/deepalert"
+	"github.com/google/go-github/v27/github"
+	"github.com/m-mizutani/golambda"
+)
+
+func reportToPath(report deepalert.Report) string {
+	return fmt.Sprintf("%s/%s/", report.CreatedAt.Format("2006/01/02"), report.ID)
+}
+
+// reportJSONPath is a path of raw report data. It can be replayed through
+// handler as SNS message.
+func reportJSONPath(report deepalert.Report) string {
+	return reportToPath(report) + "report.json"
+}
+
+// alertJSONPath is a path of raw alert data next to the markdown file
+func alertJSONPath(alertPath string) string {
+	return strings.TrimSuffix(alertPath, ".md") + ".json"
+}
+
+// alertToPath returns a file path of the alert. The path is identified by
+// timestamp and hash of alert data, then same alert is always written to
+// same path even if rendering is changed.
+func alertToPath(report deepalert.Report, alert *deepalert.Alert) (string, error) {
+	raw, err := json.Marshal(alert)
+	if err != nil {
+		return "", golambda.WrapError(err, "Failed to marshal alert")
+	}
+
+	return fmt.Sprintf("%s%s_%040x.md", reportToPath(report),
+		alert.Timestamp.Format("20060102_150405"), sha1.Sum(raw)), nil
+}
+
+func alertToMarkdown(alert *deepalert.Alert, opt bodyOptions) ([]byte, error) {
+	return renderNodes(buildAlert(alert, opt))
+}
+
+// archiveFile is a file to be committed to the alert archive
+type archiveFile struct {
+	Path string
+	Data []byte
+}
+
+// maxCommitAttempts is limit to retry commit when the branch is moved by
+// other process during building commit.
+const maxCommitAttempts = 3
+
+// archiveBuilder builds files to be committed on the head commit. It is
+// called again with the new head when the commit is rebuilt.
+type archiveBuilder func(headSHA string) ([]archiveFile, error)
+
+// commitFiles commits all files in one commit on the branch via Git Data API.
+// Existing files are overwritten and the commit is skipped if no file is
+// changed. If the branch is updated by other process before updating ref, the
+// commit is rebuilt on the new head.
+func commitFiles(ctx context.Context, client *github.Client, owner, repo, branch, message string, build archiveBuilder) (string, error) {
+	for attempt := 1; ; attempt++ {
+		head, resp, err := client.Repositories.GetBranch(ctx, owner, repo, branch)
+		if err != nil {
+			return "", wrapGithubError(err, "Failed to get branch", resp).
+				With("owner", owner).
+				With("repo", repo).
+				With("branch", branch)
+		}
+		headSHA := head.GetCommit().GetSHA()
+		baseTreeSHA := head.GetCommit().GetCommit().GetTree().GetSHA()
+
+		files, err := build(headSHA)
+		if err != nil {
+			return "", err
+		}
+
+		var entries []github.TreeEntry
+		for _, file := range files {
+			// Blob is created by tree API with content
+			entries = append(entries, github.TreeEntry{
+				Path:    github.String(file.Path),
+				Mode:    github.String("100644"),
+				Type:    github.String("blob"),
+				Content: github.String(string(file.Data)),
+			})
+		}
+
+		tree, resp, err := client.Git.CreateTree(ctx, owner, repo, baseTreeSHA, entries)
+		if err != nil {
+			return "", wrapGithubError(err, "Failed to create a tree", resp).
+				With("owner", owner).
+				With("repo", repo).
+				With("baseTree", baseTreeSHA)
+		}
+		if tree.GetSHA() == baseTreeSHA {
+			logger.With("branch", branch).With("head", headSHA).Info("No file is changed, skip commit")
+			return headSHA, nil
+		}
+
+		commit, resp, err := client.Git.CreateCommit(ctx, owner, repo, &github.Commit{
+			Message: github.String(message),
+			Tree:    &github.Tree{SHA: tree.SHA},
+			Parents: []github.Commit{{SHA: github.String(headSHA)}},
+		})
+		if err != nil {
+			return "", wrapGithubError(err, "Failed to create a commit", resp).
+				With("owner", owner).
+				With("repo", repo).
+				With("tree", tree.GetSHA())
+		}
+
+		ref := &github.Reference{
+			Ref:    github.String("refs/heads/" + branch),
+			Object: &github.GitObject{SHA: commit.SHA},
+		}
+		_, resp, err = client.Git.UpdateRef(ctx, owner, repo, ref, false)
+		if err == nil {
+			return commit.GetSHA(), nil
+		}
+
+		// 422 means not fast-forward because the branch has been moved
+		if resp != nil && resp.StatusCode == http.StatusUnprocessableEntity && attempt < maxCommitAttempts {
+			logger.With("branch", branch).
+				With("attempt", attempt).
+				With("commit", commit.GetSHA()).
+				Info("Branch has been moved, rebuild commit on the new head")
+			continue
+		}
+
+		return "", wrapGithubError(err, "Failed to update ref", resp).
+			With("owner", owner).
+			With("repo", repo).
+			With("branch", branch).
+			With("commit", commit.GetSHA())
+	}
+}
+
+// alertCommitMessage does not include rule name and description of alerts
+// because closing keywords and issue references in commit message, e.g.
+// "fixes #12", take effect on the default branch.
+func alertCommitMessage(report deepalert.Report) string {
+	if len(report.Alerts) == 1 {
+		return fmt.Sprintf("[Alert] report %s", report.ID)
+	}
+	return fmt.Sprintf("[Alert] %d alerts of report %s", len(report.Alerts), report.ID)
+}
+
+// buildArchiveFiles builds markdown files of alerts and JSON files of alerts
+// and the report. They do not depend on current contents of the archive.
+func buildArchiveFiles(report deepalert.Report, settings githubSettings) ([]archiveFile, []archiveFile, error) {
+	var alertFiles []archiveFile
+	for _, alert := range report.Alerts {
+		path, err := alertToPath(report, alert)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		data, err := alertToMarkdown(alert, settings.bodyOptions(""))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		alertFiles = append(alertFiles, archiveFile{Path: path, Data: data})
+	}
+
+	var jsonFiles []archiveFile
+	for i, alert := range report.Alerts {
+		data, err := toArchiveJSON(alert, settings.ArchiveRedactFields)
+		if err != nil {
+			return nil, nil, err
+		}
+		jsonFiles = append(jsonFiles, archiveFile{Path: alertJSONPath(alertFiles[i].Path), Data: data})
+	}
+	reportJSON, err := toArchiveJSON(report, settings.ArchiveRedactFields)
+	if err != nil {
+		return nil, nil, err
+	}
+	jsonFiles = append(jsonFiles, archiveFile{Path: reportJSONPath(report), Data: reportJSON})
+
+	return alertFiles, jsonFiles, nil
+}
+
+// publishAlert commits all alert files of the report with index files of the
+// report directory and the day in a single commit.
+func publishAlert(ctx context.Context, api githubAPI, report deepalert.Report, settings githubSettings) (string, error) {
+	if len(report.Alerts) == 0 {
+		return "", nil
+	}
+
+	owner, repo, err := splitRepo(settings.GithubRepo)
+	if err != nil {
+		return "", err
+	}
+
+	branch, err := api.resolveBranch(ctx, owner, repo, settings.GithubBranch)
+	if err != nil {
+		return "", err
+	}
+
+	alertFiles, jsonFiles, err := buildArchiveFiles(report, settings)
+	if err != nil {
+		return "", err
+	}
+
+	title, err := reportToTitle(report, settings.GithubTitleTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	build := func(headSHA string) ([]archiveFile, error) {
+		files := append([]archiveFile{}, alertFiles...)
+		files = append(files, jsonFiles...)
+
+		readme, err := buildReportIndex(ctx, api, owner, repo, headSHA, report, title, alertFiles, now)
+		if err != nil {
+			return nil, err
+		}
+		daily, err := buildDailyIndex(ctx, api, owner, repo, headSHA, report, title)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(files, *readme, *daily), nil
+	}
+
+	commit, err := api.commitFiles(ctx, owner, repo, branch, alertCommitMessage(report), build)
+	if err != nil {
+		return "", err
+	}
+	logger.With("commit", commit).With("files", len(alertFiles)).Info("Committed alert files")
+
+	return reportToPath(report), nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/deepalert/deepalert"
+	"github.com/deepalert/deepalert-github/src/md"
+	"github.com/google/go-github/v27/github"
+	"github.com/m-mizutani/golambda"
+)
+
+const archiveIndexName = "README.md"
+
+// statusRecord is an entry of status history of a report
+type statusRecord struct {
+	Status    deepalert.ReportStatus   `json:"status"`
+	Severity  deepalert.ReportSeverity `json:"severity,omitempty"`
+	Timestamp time.Time                `json:"timestamp"`
+}
+
+// dailyEntry is a report entry of daily index
+type dailyEntry struct {
+	ReportID  deepalert.ReportID       `json:"report_id"`
+	Title     string                   `json:"title"`
+	Status    deepalert.ReportStatus   `json:"status"`
+	Severity  deepalert.ReportSeverity `json:"severity,omitempty"`
+	Alerts    int                      `json:"alerts"`
+	CreatedAt time.Time                `json:"created_at"`
+}
+
+func reportIndexPath(report deepalert.Report) string {
+	return reportToPath(report) + archiveIndexName
+}
+
+func dailyIndexPath(report deepalert.Report) string {
+	return fmt.Sprintf("%s/%s", report.CreatedAt.Format("2006/01/02"), archiveIndexName)
+}
+
+// embedJSON returns hidden HTML comment to keep state of a generated file.
+// JSON encoder escapes '<' and '>', then the comment is never closed in JSON.
+func embedJSON(key string, v interface{}) (string, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", golambda.WrapError(err, "Failed to marshal embedded data").With("key", key)
+	}
+	return fmt.Sprintf("<!-- %s: %s -->\n", key, string(raw)), nil
+}
+
+func extractJSON(data []byte, key string, v interface{}) error {
+	ptn := regexp.MustCompile(fmt.Sprintf(`<!-- %s: (.*?) -->`, regexp.QuoteMeta(key)))
+	m := ptn.FindSubmatch(data)
+	if m == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(m[1], v); err != nil {
+		return golambda.WrapError(err, "Failed to parse embedded data").With("key", key)
+	}
+	return nil
+}
+
+// readArchiveFile returns content of the file at ref. It returns nil without
+// error if the file does not exist.
+func readArchiveFile(ctx context.Context, client *github.Client, owner, repo, ref, filePath string) ([]byte, error) {
+	file, _, resp, err := client.Repositories.GetContents(ctx, owner, repo, filePath,
+		&github.RepositoryContentGetOptions{Ref: ref})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, wrapGithubError(err, "Failed to get a file", resp).
+			With("owner", owner).
+			With("repo", repo).
+			With("path", filePath)
+	}
+	if file == nil {
+		return nil, golambda.NewError("Path is not a file").With("path", filePath)
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, golambda.WrapError(err, "Failed to decode file content").With("path", filePath)
+	}
+	return []byte(content), nil
+}
+
+func renderNodes(nodes []md.Node) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	for _, node := range nodes {
+		if err := node.Render(buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// appendStatus adds current status of the report to history. Same status
+// and severity with the last record is not added again.
+func appendStatus(history []statusRecord, report deepalert.Report, now time.Time) []statusRecord {
+	if n := len(history); n > 0 &&
+		history[n-1].Status == report.Status &&
+		history[n-1].Severity == report.Result.Severity {
+		return history
+	}
+
+	return append(history, statusRecord{
+		Status:    report.Status,
+		Severity:  report.Result.Severity,
+		Timestamp: now,
+	})
+}
+
+// buildReportIndex generates README.md of the report directory with summary,
+// status history and links to alert files.
+func buildReportIndex(ctx context.Context, api githubAPI, owner, repo, ref string, report deepalert.Report, title string, alertFiles []archiveFile, now time.Time) (*archiveFile, error) {
+	const historyKey = "deepalert-history"
+	indexPath := reportIndexPath(report)
+
+	current, err := api.readFile(ctx, owner, repo, ref, indexPath)
+	if err != nil {
+		return nil, err
+	}
+	var history []statusRecord
+	if err := extractJSON(current, historyKey, &history); err != nil {
+		return nil, err
+	}
+	history = appendStatus(history, report, now)
+
+	summary := &md.List{Items: []md.ListItem{
+		{Content: md.Contents{md.ToLiteral("Title: "), md.ToText(title)}},
+		{Content: md.Contents{md.ToLiteral("Status: "), md.ToCode(string(report.Status))}},
+	}}
+	if report.Result.Severity != "" {
+		summary.Items = append(summary.Items,
+			md.ListItem{Content: md.Contents{md.ToLiteral("Severity: "), md.ToBold(string(report.Result.Severity))}},
+			md.ListItem{Content: md.Contents{md.ToLiteral("Reason: "), md.ToText(report.Result.Reason)}},
+		)
+	}
+	summary.Items = append(summary.Items,
+		md.ListItem{Content: md.Contents{md.ToLiteral("Created at: "), md.ToCode(report.CreatedAt.Format(timeFormat))}},
+	)
+
+	historyTable := &md.Table{Haed: md.TableHead{Cols: []md.TableCol{
+		{Content: md.ToLiteral("Timestamp")},
+		{Content: md.ToLiteral("Status")},
+		{Content: md.ToLiteral("Severity")},
+	}}}
+	for _, record := range history {
+		historyTable.Rows = append(historyTable.Rows, md.TableRow{Cols: []md.TableCol{
+			{Content: md.ToLiteral(record.Timestamp.Format(timeFormat))},
+			{Content: md.ToLiteral(string(record.Status))},
+			{Content: md.ToLiteral(string(record.Severity))},
+		}})
+	}
+
+	alertTable := &md.Table{Haed: md.TableHead{Cols: []md.TableCol{
+		{Content: md.ToLiteral("Detected at")},
+		{Content: md.ToLiteral("Rule")},
+		{Content: md.ToLiteral("Description")},
+		{Content: md.ToLiteral("File")},
+	}}}
+	for i, alert := range report.Alerts {
+		name := path.Base(alertFiles[i].Path)
+		alertTable.Rows = append(alertTable.Rows, md.TableRow{Cols: []md.TableCol{
+			{Content: md.ToLiteral(alert.Timestamp.Format(timeFormat))},
+			{Content: md.ToText(alert.RuleName)},
+			{Content: md.ToText(alert.Description)},
+			{Content: &md.Link{Content: md.ToLiteral(name), URL: "./" + name}},
+		}})
+	}
+
+	embedded, err := embedJSON(historyKey, history)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := renderNodes([]md.Node{
+		&md.Heading{Level: 1, Content: md.Contents{md.ToLiteral("Report "), md.ToCode(string(report.ID))}},
+		summary,
+		&md.Heading{Level: 2, Content: md.ToLiteral("Status history")},
+		historyTable,
+		&md.Heading{Level: 2, Content: md.ToLiteral("Alerts")},
+		alertTable,
+		md.ToRaw(embedded),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &archiveFile{Path: indexPath, Data: data}, nil
+}
+
+// buildDailyIndex generates README.md of the day directory with all reports
+// created on the day.
+func buildDailyIndex(ctx context.Context, api githubAPI, owner, repo, ref string, report deepalert.Report, title string) (*archiveFile, error) {
+	const indexKey = "deepalert-index"
+	indexPath := dailyIndexPath(report)
+
+	current, err := api.readFile(ctx, owner, repo, ref, indexPath)
+	if err != nil {
+		return nil, err
+	}
+	entries := map[deepalert.ReportID]*dailyEntry{}
+	if err := extractJSON(current, indexKey, &entries); err != nil {
+		return nil, err
+	}
+
+	entries[report.ID] = &dailyEntry{
+		ReportID:  report.ID,
+		Title:     title,
+		Status:    report.Status,
+		Severity:  report.Result.Severity,
+		Alerts:    len(report.Alerts),
+		CreatedAt: report.CreatedAt,
+	}
+
+	var sorted []*dailyEntry
+	for _, entry := range entries {
+		sorted = append(sorted, entry)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].CreatedAt.Equal(sorted[j].CreatedAt) {
+			return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+		}
+		return sorted[i].ReportID < sorted[j].ReportID
+	})
+
+	table := &md.Table{Haed: md.TableHead{Cols: []md.TableCol{
+		{Content: md.ToLiteral("Created at")},
+		{Content: md.ToLiteral("Report")},
+		{Content: md.ToLiteral("Title")},
+		{Content: md.ToLiteral("Status")},
+		{Content: md.ToLiteral("Severity")},
+		{Content: md.ToLiteral("Alerts"), Align: md.AlignRight},
+	}}}
+	for _, entry := range sorted {
+		table.Rows = append(table.Rows, md.TableRow{Cols: []md.TableCol{
+			{Content: md.ToLiteral(entry.CreatedAt.Format(timeFormat))},
+			{Content: &md.Link{
+				Content: md.ToCode(string(entry.ReportID)),
+				URL:     fmt.Sprintf("./%s/", entry.ReportID),
+			}},
+			{Content: md.ToText(entry.Title)},
+			{Content: md.ToLiteral(string(entry.Status))},
+			{Content: md.ToLiteral(string(entry.Severity))},
+			{Content: md.ToLiteral(fmt.Sprintf("%d", entry.Alerts))},
+		}})
+	}
+
+	embedded, err := embedJSON(indexKey, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := renderNodes([]md.Node{
+		&md.Heading{Level: 1, Content: md.ToLiteral("Reports of " + report.CreatedAt.Format("2006-01-02"))},
+		table,
+		md.ToRaw(embedded),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &archiveFile{Path: indexPath, Data: data}, nil
+}
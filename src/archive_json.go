@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/m-mizutani/golambda"
+)
+
+const redactedValue = "[REDACTED]"
+
+// stringList can be given as either JSON array of string or comma separated
+// string for a value of SecretsManager and environment variable.
+type stringList []string
+
+func (x *stringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*x = parseStringList(s)
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return golambda.WrapError(err, "Failed to parse string list").With("data", string(data))
+	}
+	*x = list
+	return nil
+}
+
+func parseStringList(s string) stringList {
+	var list stringList
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// isRedacted checks if the dotted field path (indexes of array are skipped)
+// is one of redact fields or ends with it. E.g. "attributes.value" redacts
+// both of "attributes.value" and "alerts.attributes.value".
+func isRedacted(fieldPath string, redactFields []string) bool {
+	for _, field := range redactFields {
+		if fieldPath == field || strings.HasSuffix(fieldPath, "."+field) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactJSON(v interface{}, fieldPath string, redactFields []string) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			childPath := key
+			if fieldPath != "" {
+				childPath = fieldPath + "." + key
+			}
+
+			if isRedacted(childPath, redactFields) {
+				value[key] = redactedValue
+			} else {
+				value[key] = redactJSON(child, childPath, redactFields)
+			}
+		}
+		return value
+
+	case []interface{}:
+		for i, child := range value {
+			value[i] = redactJSON(child, fieldPath, redactFields)
+		}
+		return value
+
+	default:
+		return v
+	}
+}
+
+// toArchiveJSON encodes v as indented JSON with redaction of fields.
+func toArchiveJSON(v interface{}, redactFields []string) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, golambda.WrapError(err, "Failed to marshal archive data")
+	}
+
+	if len(redactFields) > 0 {
+		var data interface{}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&data); err != nil {
+			return nil, golambda.WrapError(err, "Failed to decode archive data")
+		}
+
+		if raw, err = json.Marshal(redactJSON(data, "", redactFields)); err != nil {
+			return nil, golambda.WrapError(err, "Failed to marshal redacted archive data")
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := json.Indent(buf, raw, "", "  "); err != nil {
+		return nil, golambda.WrapError(err, "Failed to indent archive data")
+	}
+	buf.WriteString("\n")
+
+	return buf.Bytes(), nil
+}
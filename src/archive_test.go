@@ -0,0 +1,277 @@
+package main_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deepalert/deepalert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/deepalert/deepalert-github/src"
+)
+
+type gitTreeEntry struct {
+	Path    string `json:"path"`
+	Mode    string `json:"mode"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+}
+
+type gitTreeRequest struct {
+	BaseTree string         `json:"base_tree"`
+	Tree     []gitTreeEntry `json:"tree"`
+}
+
+type gitCommitRequest struct {
+	Message string   `json:"message"`
+	Tree    string   `json:"tree"`
+	Parents []string `json:"parents"`
+}
+
+func newAlertReport(n int) deepalert.Report {
+	report := newTestReport()
+	report.Status = deepalert.StatusNew
+	report.CreatedAt = time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	report.Alerts = nil
+	for i := 0; i < n; i++ {
+		report.Alerts = append(report.Alerts, &deepalert.Alert{
+			Detector:    "blue",
+			RuleName:    "orange",
+			Description: fmt.Sprintf("alert %d", i),
+			Timestamp:   report.CreatedAt,
+		})
+	}
+	return report
+}
+
+func TestAlertToPath(t *testing.T) {
+	report := newAlertReport(2)
+	p0, err := main.AlertToPath(report, report.Alerts[0])
+	require.NoError(t, err)
+	p1, err := main.AlertToPath(report, report.Alerts[1])
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(p0, "2021/01/02/"+string(report.ID)+"/20210102_030405_"))
+	assert.NotEqual(t, p0, p1)
+}
+
+func TestPublishAlertSingleCommit(t *testing.T) {
+	report := newAlertReport(3)
+
+	var heads []string
+	var trees []gitTreeRequest
+	var commits []gitCommitRequest
+	var refs []map[string]interface{}
+
+	mux := http.NewServeMux()
+	handleRepository(mux, "blue/orange", "main")
+	mux.HandleFunc("/repos/blue/orange/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		// Branch is moved after the first commit is built
+		head := fmt.Sprintf("head%d", len(heads))
+		heads = append(heads, head)
+		fmt.Fprintf(w, `{"name":"main","commit":{"sha":%q,"commit":{"tree":{"sha":"tree-%s"}}}}`, head, head)
+	})
+	mux.HandleFunc("/repos/blue/orange/git/trees", func(w http.ResponseWriter, r *http.Request) {
+		var req gitTreeRequest
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&req)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		trees = append(trees, req)
+		fmt.Fprintf(w, `{"sha":"new-%s"}`, req.BaseTree)
+	})
+	mux.HandleFunc("/repos/blue/orange/git/commits", func(w http.ResponseWriter, r *http.Request) {
+		var req gitCommitRequest
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&req)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		commits = append(commits, req)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"sha":"commit-%s"}`, req.Parents[0])
+	})
+	mux.HandleFunc("/repos/blue/orange/git/refs/heads/main", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "PATCH", r.Method)
+		var req map[string]interface{}
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&req)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		refs = append(refs, req)
+		if len(refs) == 1 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"message":"Update is not a fast forward"}`)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	})
+
+	client := newTestClient(t, mux)
+	path, err := main.PublishAlert(client, report, main.GithubSettings{GithubRepo: "blue/orange"})
+	require.NoError(t, err)
+	assert.Equal(t, "2021/01/02/"+string(report.ID)+"/", path)
+
+	// Rebuilt on the moved head
+	require.Equal(t, 2, len(trees))
+	assert.Equal(t, "tree-head0", trees[0].BaseTree)
+	assert.Equal(t, "tree-head1", trees[1].BaseTree)
+	require.Equal(t, 9, len(trees[1].Tree))
+	for i, entry := range trees[1].Tree[:3] {
+		expected, err := main.AlertToPath(report, report.Alerts[i])
+		require.NoError(t, err)
+		assert.Equal(t, expected, entry.Path)
+		assert.Equal(t, "100644", entry.Mode)
+		assert.Contains(t, entry.Content, fmt.Sprintf("alert %d", i))
+	}
+	for i, entry := range trees[1].Tree[3:6] {
+		expected, err := main.AlertToPath(report, report.Alerts[i])
+		require.NoError(t, err)
+		assert.Equal(t, strings.TrimSuffix(expected, ".md")+".json", entry.Path)
+
+		var alert deepalert.Alert
+		require.NoError(t, json.Unmarshal([]byte(entry.Content), &alert))
+		assert.Equal(t, report.Alerts[i].Description, alert.Description)
+	}
+	assert.Equal(t, "2021/01/02/"+string(report.ID)+"/report.json", trees[1].Tree[6].Path)
+	var replay deepalert.Report
+	require.NoError(t, json.Unmarshal([]byte(trees[1].Tree[6].Content), &replay))
+	assert.Equal(t, report.ID, replay.ID)
+	assert.Equal(t, 3, len(replay.Alerts))
+	assert.Equal(t, "2021/01/02/"+string(report.ID)+"/README.md", trees[1].Tree[7].Path)
+	assert.Equal(t, "2021/01/02/README.md", trees[1].Tree[8].Path)
+
+	require.Equal(t, 2, len(commits))
+	assert.Equal(t, []string{"head1"}, commits[1].Parents)
+	assert.Equal(t, "new-tree-head1", commits[1].Tree)
+	assert.Contains(t, commits[1].Message, "3 alerts")
+
+	require.Equal(t, 2, len(refs))
+	assert.Equal(t, "commit-head1", refs[1]["sha"])
+	assert.Equal(t, false, refs[1]["force"])
+}
+
+func TestPublishAlertNoChange(t *testing.T) {
+	report := newAlertReport(1)
+
+	mux := http.NewServeMux()
+	handleRepository(mux, "blue/orange", "main")
+	mux.HandleFunc("/repos/blue/orange/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name":"main","commit":{"sha":"head","commit":{"tree":{"sha":"same"}}}}`)
+	})
+	mux.HandleFunc("/repos/blue/orange/git/trees", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha":"same"}`)
+	})
+	mux.HandleFunc("/repos/blue/orange/git/commits", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("commit must not be created if no file is changed")
+	})
+
+	client := newTestClient(t, mux)
+	_, err := main.PublishAlert(client, report, main.GithubSettings{GithubRepo: "blue/orange"})
+	require.NoError(t, err)
+}
+
+func TestPublishAlertIndex(t *testing.T) {
+	report := newAlertReport(1)
+	report.Status = deepalert.StatusPublished
+	report.Result.Severity = deepalert.SevUrgent
+	alertPath, err := main.AlertToPath(report, report.Alerts[0])
+	require.NoError(t, err)
+
+	existingReadme := "# old\n" + `<!-- deepalert-history: [{"status":"new","timestamp":"2021-01-02T03:04:05Z"}] -->` + "\n"
+	existingDaily := "# old\n" + `<!-- deepalert-index: {"other-report":{"report_id":"other-report","title":"[x] y: z","status":"new","alerts":2,"created_at":"2021-01-02T01:00:00Z"}} -->` + "\n"
+	contents := map[string]string{
+		"/repos/blue/orange/contents/2021/01/02/" + string(report.ID) + "/README.md": existingReadme,
+		"/repos/blue/orange/contents/2021/01/02/README.md":                           existingDaily,
+	}
+
+	var tree gitTreeRequest
+	mux := http.NewServeMux()
+	handleRepository(mux, "blue/orange", "main")
+	mux.HandleFunc("/repos/blue/orange/contents/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "head", r.URL.Query().Get("ref"))
+		content, ok := contents[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]string{
+			"type":     "file",
+			"encoding": "base64",
+			"content":  base64.StdEncoding.EncodeToString([]byte(content)),
+		}))
+	})
+	mux.HandleFunc("/repos/blue/orange/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name":"main","commit":{"sha":"head","commit":{"tree":{"sha":"base"}}}}`)
+	})
+	mux.HandleFunc("/repos/blue/orange/git/trees", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&tree)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"sha":"new"}`)
+	})
+	mux.HandleFunc("/repos/blue/orange/git/commits", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"sha":"commit"}`)
+	})
+	mux.HandleFunc("/repos/blue/orange/git/refs/heads/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	})
+
+	client := newTestClient(t, mux)
+	_, err = main.PublishAlert(client, report, main.GithubSettings{GithubRepo: "blue/orange"})
+	require.NoError(t, err)
+	require.Equal(t, 5, len(tree.Tree))
+
+	readme := tree.Tree[3].Content
+	if os.Getenv("VERBOSE") != "" {
+		fmt.Println(readme)
+	}
+	assert.Contains(t, readme, "# Report  `"+string(report.ID)+"` \n")
+	assert.Contains(t, readme, "| 2021-01-02 03:04 | new |  |\n")
+	assert.Contains(t, readme, "| published | urgent |\n")
+	assert.Contains(t, readme, fmt.Sprintf("[%s](./%s)", path.Base(alertPath), path.Base(alertPath)))
+
+	daily := tree.Tree[4].Content
+	if os.Getenv("VERBOSE") != "" {
+		fmt.Println(daily)
+	}
+	assert.Contains(t, daily, "# Reports of 2021-01-02")
+	assert.Contains(t, daily, "[ `other-report` ](./other-report/)")
+	assert.Contains(t, daily, fmt.Sprintf("[ `%s` ](./%s/)", report.ID, report.ID))
+	assert.Less(t, strings.Index(daily, "other-report"), strings.Index(daily, string(report.ID)))
+}
+
+func TestToArchiveJSONRedaction(t *testing.T) {
+	report := newAlertReport(1)
+	report.Alerts[0].Attributes = []deepalert.Attribute{
+		{Type: deepalert.TypeUserName, Key: "user", Value: "mizutani"},
+	}
+	report.Alerts[0].Body = map[string]interface{}{"password": "s3cr3t", "count": 12345678901234567}
+
+	data, err := main.ToArchiveJSON(report, []string{"attributes.value", "body.password"})
+	require.NoError(t, err)
+	raw := string(data)
+	assert.NotContains(t, raw, "mizutani")
+	assert.NotContains(t, raw, "s3cr3t")
+	assert.Contains(t, raw, "12345678901234567")
+	assert.Contains(t, raw, `"[REDACTED]"`)
+
+	var replay deepalert.Report
+	require.NoError(t, json.Unmarshal(data, &replay))
+	assert.Equal(t, "user", replay.Alerts[0].Attributes[0].Key)
+	assert.Equal(t, "[REDACTED]", replay.Alerts[0].Attributes[0].Value)
+
+	// Without redaction, output is the same data as original
+	data, err = main.ToArchiveJSON(report.Alerts[0], nil)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "mizutani")
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/deepalert/deepalert"
+	"github.com/google/go-github/v27/github"
+)
+
+// assignRule places an issue of matched report. All matched rules are applied.
+type assignRule struct {
+	reportMatcher
+	// Assignees are GitHub user names to be assigned
+	Assignees []string `json:"assignees,omitempty"`
+	// Mentions are users or teams (e.g. "org/team") to be mentioned in issue body
+	Mentions []string `json:"mentions,omitempty"`
+	// Milestone is number of milestone in the repository
+	Milestone int `json:"milestone,omitempty"`
+	// ProjectColumnID is ID of a project board column to add the issue as card
+	ProjectColumnID int64 `json:"project_column_id,omitempty"`
+}
+
+type assignRules []assignRule
+
+func (x *assignRules) UnmarshalJSON(data []byte) error {
+	var rules []assignRule
+	if err := unmarshalEmbeddedJSON(data, &rules); err != nil {
+		return err
+	}
+	*x = rules
+	return nil
+}
+
+// issuePlacement is merged result of matched assignRules. The first non-zero
+// Milestone and ProjectColumnID are used.
+type issuePlacement struct {
+	Assignees       []string
+	Mentions        []string
+	Milestone       int
+	ProjectColumnID int64
+}
+
+func appendUniq(base []string, items ...string) []string {
+	for _, item := range items {
+		exists := false
+		for _, b := range base {
+			if strings.EqualFold(b, item) {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			base = append(base, item)
+		}
+	}
+	return base
+}
+
+func (x assignRules) resolve(report deepalert.Report) *issuePlacement {
+	var placement issuePlacement
+	for _, rule := range x {
+		if !rule.match(report) {
+			continue
+		}
+
+		placement.Assignees = appendUniq(placement.Assignees, rule.Assignees...)
+		placement.Mentions = appendUniq(placement.Mentions, rule.Mentions...)
+		if placement.Milestone == 0 {
+			placement.Milestone = rule.Milestone
+		}
+		if placement.ProjectColumnID == 0 {
+			placement.ProjectColumnID = rule.ProjectColumnID
+		}
+	}
+
+	return &placement
+}
+
+// mentionText returns a line to mention users and teams in issue body.
+func (x *issuePlacement) mentionText() string {
+	if len(x.Mentions) == 0 {
+		return ""
+	}
+
+	var mentions []string
+	for _, m := range x.Mentions {
+		mentions = append(mentions, "@"+strings.TrimPrefix(m, "@"))
+	}
+	return "cc: " + strings.Join(mentions, " ") + "\n\n"
+}
+
+// validAssignees filters assignees who can not be assigned to an issue of the
+// repository. They are skipped with logging instead of failing to publish.
+func validAssignees(ctx context.Context, client *github.Client, owner, repo string, assignees []string) []string {
+	var valid []string
+	for _, assignee := range assignees {
+		ok, resp, err := client.Issues.IsAssignee(ctx, owner, repo, assignee)
+		if err != nil {
+			logger.With("error", wrapGithubError(err, "Failed to check assignee", resp)).
+				With("owner", owner).
+				With("repo", repo).
+				With("assignee", assignee).
+				Error("Skip assignee because failed to check")
+			continue
+		}
+		if !ok {
+			logger.With("owner", owner).
+				With("repo", repo).
+				With("assignee", assignee).
+				Error("Skip assignee because the user can not be assigned")
+			continue
+		}
+
+		valid = append(valid, assignee)
+	}
+
+	return valid
+}
+
+// addProjectCard adds the issue to a project column. Failure is logged but
+// not returned because the issue has been created already.
+func addProjectCard(ctx context.Context, client *github.Client, columnID int64, issue *github.Issue) {
+	opt := &github.ProjectCardOptions{
+		ContentID:   issue.GetID(),
+		ContentType: "Issue",
+	}
+	if _, resp, err := client.Projects.CreateProjectCard(ctx, columnID, opt); err != nil {
+		logger.With("error", wrapGithubError(err, "Failed to create a project card", resp)).
+			With("columnID", columnID).
+			With("number", issue.GetNumber()).
+			Error("Skip adding issue to project column")
+		return
+	}
+
+	logger.With("columnID", columnID).With("number", issue.GetNumber()).Info("Added issue to project column")
+}
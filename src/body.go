@@ -11,9 +11,26 @@ import (
 
 const timeFormat = "2006-01-02 15:04"
 
-func attrToContents(attr *deepalert.Attribute) md.Contents {
+// bodyOptions has parameters to build issue body other than report
+type bodyOptions struct {
+	// Branch has alert files of the report
+	Branch string
+	// Template is text/template of issue body. Default layout is used if empty.
+	Template string
+	// Defang renders IP address, domain name and URL not to be clicked, e.g.
+	// hxxp://evil[.]example[.]com. Original values are kept in raw section.
+	Defang bool
+	// EnrichLinks are quick-pivot links of attribute values by type
+	EnrichLinks enrichLinks
+	// MaxRows and MaxCodeLength limit rows of tables and length of code
+	// blocks to fit issue body in size limit. Zero means no limit.
+	MaxRows       int
+	MaxCodeLength int
+}
+
+func attrToContents(attr *deepalert.Attribute, opt bodyOptions) md.Contents {
 	nodes := []md.Node{
-		md.ToLiteral(fmt.Sprintf("%s", attr.Key)),
+		md.ToText(attr.Key),
 	}
 
 	switch attr.Type {
@@ -36,13 +53,15 @@ func attrToContents(attr *deepalert.Attribute) md.Contents {
 		nodes = append(nodes, []md.Node{
 			md.ToLiteral(" ("),
 			md.ToCode(string(attr.Type)),
-			md.ToLiteral("): \n"),
-			md.ToCodeBlock(jdata),
-			md.ToLiteral("\n"),
+			md.ToRaw("): \n"),
+			md.ToCodeBlock(limitCode(jdata, opt)),
+			md.ToRaw("\n"),
 		}...)
 
 	case deepalert.TypeURL:
-		if attr.Context.Have(deepalert.CtxAdditionalInfo) {
+		if opt.Defang {
+			nodes = append(nodes, md.ToCode(defangURL(attr.Value)))
+		} else if attr.Context.Have(deepalert.CtxAdditionalInfo) {
 			nodes = append(nodes, []md.Node{
 				md.ToLiteral(": "),
 				&md.Link{
@@ -59,19 +78,23 @@ func attrToContents(attr *deepalert.Attribute) md.Contents {
 			md.ToLiteral(" ("),
 			md.ToCode(string(attr.Type)),
 			md.ToLiteral("): "),
-			md.ToCode(attr.Value),
+			md.ToCode(opt.attrValue(attr)),
 		}...)
 	}
 
+	if attr.Type != deepalert.TypeJSON {
+		nodes = append(nodes, buildEnrichLinks(attr.Type, attr.Key, attr.Value, opt)...)
+	}
+
 	return md.Contents(nodes)
 }
 
-func buildSummary(report deepalert.Report) []md.Node {
+func buildSummary(report deepalert.Report, opt bodyOptions) []md.Node {
 	attrList := &md.List{}
 
 	for _, attr := range report.Attributes {
 		attrList.Items = append(attrList.Items, md.ListItem{
-			Content: attrToContents(attr),
+			Content: attrToContents(attr, opt),
 		})
 	}
 
@@ -88,7 +111,7 @@ func buildSummary(report deepalert.Report) []md.Node {
 				}},
 				{Content: md.Contents{
 					md.ToLiteral("Reason: "),
-					md.ToLiteral(report.Result.Reason),
+					md.ToText(report.Result.Reason),
 				}},
 				{Content: md.Contents{
 					md.ToLiteral("Detected by "),
@@ -102,7 +125,11 @@ func buildSummary(report deepalert.Report) []md.Node {
 					md.ToLiteral("Created at: " + report.CreatedAt.String()),
 				}},
 				{Content: md.Contents{
-					md.ToLiteralf("Alert reports: [link](../tree/master/%s)", reportToPath(report)),
+					md.ToLiteral("Alert reports: "),
+					&md.Link{
+						Content: md.ToLiteral("link"),
+						URL:     alertsURL(report, opt),
+					},
 				}},
 			},
 		},
@@ -116,6 +143,15 @@ func buildSummary(report deepalert.Report) []md.Node {
 	return nodes
 }
 
+// toCodeOrEmpty renders an identifier in table cell as code to be copied as
+// it is. Empty value is rendered as empty cell instead of empty code span.
+func toCodeOrEmpty(s string) md.Node {
+	if s == "" {
+		return md.Contents{}
+	}
+	return md.ToCode(s)
+}
+
 func joinAsCode(ss []string) []md.Node {
 	var nodes []md.Node
 	for i, s := range ss {
@@ -127,7 +163,7 @@ func joinAsCode(ss []string) []md.Node {
 	return nodes
 }
 
-func buildInspections(report deepalert.Report) []md.Node {
+func buildInspections(report deepalert.Report, opt bodyOptions) []md.Node {
 	nodes := []md.Node{
 		&md.Heading{
 			Level:   1,
@@ -136,21 +172,27 @@ func buildInspections(report deepalert.Report) []md.Node {
 	}
 
 	for _, section := range report.Sections {
-		nodes = append(nodes, buildHostInspections(section.Hosts, section.Attr)...)
-		nodes = append(nodes, buildUserInspections(section.Users, section.Attr)...)
-		nodes = append(nodes, buildBinaryInspections(section.Binaries, section.Attr)...)
+		nodes = append(nodes, buildSection(section, opt)...)
 	}
 
 	return nodes
 }
 
-func buildAlert(alert *deepalert.Alert) []md.Node {
+func buildSection(section *deepalert.Section, opt bodyOptions) []md.Node {
+	var nodes []md.Node
+	nodes = append(nodes, buildHostInspections(section.Hosts, section.Attr, opt)...)
+	nodes = append(nodes, buildUserInspections(section.Users, section.Attr, opt)...)
+	nodes = append(nodes, buildBinaryInspections(section.Binaries, section.Attr, opt)...)
+	return nodes
+}
+
+func buildAlert(alert *deepalert.Alert, opt bodyOptions) []md.Node {
 	title := fmt.Sprintf("[%s] %s: %s", alert.Detector, alert.RuleName, alert.Description)
 
 	nodes := []md.Node{
 		&md.Heading{
 			Level:   1,
-			Content: md.ToLiteral(title),
+			Content: md.ToText(title),
 		},
 	}
 
@@ -175,7 +217,7 @@ func buildAlert(alert *deepalert.Alert) []md.Node {
 				}},
 				{Content: md.Contents{
 					md.ToLiteral("Description: "),
-					md.ToLiteral(alert.Description),
+					md.ToText(alert.Description),
 				}},
 				{Content: md.Contents{
 					md.ToLiteral("Detected at: "),
@@ -189,10 +231,11 @@ func buildAlert(alert *deepalert.Alert) []md.Node {
 	attrList := &md.List{}
 	for _, attr := range alert.Attributes {
 		attrList.Items = append(attrList.Items, md.ListItem{
-			Content: attrToContents(&attr),
+			Content: attrToContents(&attr, opt),
 		})
 	}
 	nodes = append(nodes, attrList)
+	nodes = append(nodes, buildRawSection(alertRawValues(alert), opt)...)
 
 	return nodes
 }
@@ -223,16 +266,6 @@ func buildSystemReport(report deepalert.Report) (nodes []md.Node) {
 	return
 }
 
-func reportToBody(report deepalert.Report) (*bytes.Buffer, error) {
-	doc := &md.Document{}
-	doc.Extend(buildSummary(report))
-	doc.Extend(buildInspections(report))
-	doc.Extend(buildSystemReport(report))
-
-	buf := new(bytes.Buffer)
-	if err := doc.Render(buf); err != nil {
-		return nil, nil
-	}
-
-	return buf, nil
+func reportToBody(report deepalert.Report, opt bodyOptions) (*bytes.Buffer, error) {
+	return executeBodyTemplate(report, opt)
 }
@@ -141,7 +141,7 @@ func TestBodyBuild(t *testing.T) {
 		},
 	}
 
-	buf, err := main.ReportToBody(report)
+	buf, err := main.ReportToBody(report, main.BodyOptions{Branch: "main"})
 	require.NotNil(t, buf)
 	require.NoError(t, err)
 
@@ -151,6 +151,155 @@ func TestBodyBuild(t *testing.T) {
 	}
 
 	assert.Contains(t, txt, "Detected by  `blue`")
+	assert.Contains(t, txt, "Alert reports: [link](../tree/main/")
 	assert.Contains(t, txt, "- source ( `ipaddr` ):  `192.168.0.1` \n")
 	assert.NotContains(t, txt, "- source ( `ipaddr` ):  `192.168.0.1` \n- source ( `ipaddr` ):  `192.168.0.1`")
 }
+
+func TestBodyBuildBinary(t *testing.T) {
+	report := deepalert.Report{
+		Result: deepalert.ReportResult{
+			Severity: deepalert.SevUrgent,
+			Reason:   "It's test",
+		},
+		ID: deepalert.ReportID(uuid.New().String()),
+		Alerts: []*deepalert.Alert{
+			{
+				Detector:    "blue",
+				RuleName:    "orange",
+				AlertKey:    "five",
+				Description: "malware",
+				Timestamp:   time.Now(),
+			},
+		},
+		Sections: []*deepalert.Section{
+			{
+				Attr: deepalert.Attribute{
+					Type:    deepalert.TypeFileHashValue,
+					Key:     "sha256",
+					Value:   "0123456789abcdef",
+					Context: []deepalert.AttrContext{deepalert.CtxFile},
+				},
+				Binaries: []*deepalert.ContentBinary{
+					{
+						OS:       []string{"Windows"},
+						Software: []string{"Office"},
+						RelatedMalware: []deepalert.EntityMalware{
+							{
+								SHA256:    "0123456789abcdef",
+								Timestamp: time.Now(),
+								Relation:  "self",
+								Scans: []deepalert.EntityMalwareScan{
+									{Vendor: "superVender", Name: "some_malware2"},
+									{Vendor: "normalVender", Name: "some_malware"},
+								},
+							},
+						},
+						Activities: []deepalert.EntityActivity{
+							{
+								ServiceName: "magic",
+								RemoteAddr:  "10.2.3.4",
+								LastSeen:    time.Now(),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	buf, err := main.ReportToBody(report, main.BodyOptions{Branch: "main"})
+	require.NoError(t, err)
+	require.NotNil(t, buf)
+
+	txt := buf.String()
+	if os.Getenv("VERBOSE") != "" {
+		fmt.Println(txt)
+	}
+
+	assert.Contains(t, txt, "## Binary:  `0123456789abcdef` \n")
+	assert.Contains(t, txt, "- Hash:  `0123456789abcdef` \n")
+	assert.Contains(t, txt, "- OS:  `Windows` \n")
+	assert.Contains(t, txt, "- Software:  `Office` \n")
+	assert.Contains(t, txt, "### Related Malware")
+	assert.Contains(t, txt, "| Timestamp | SHA256 | Relation | normalVender | superVender |")
+	assert.Contains(t, txt, "| some_malware | some_malware2 |")
+	assert.Contains(t, txt, "### Activities")
+	assert.Contains(t, txt, "| magic |  `10.2.3.4`  |")
+}
+
+func TestBodyEscapeUntrustedData(t *testing.T) {
+	report := newTestReport()
+	report.Result.Reason = "<script>alert(1)</script>"
+	report.Alerts[0].Description = "evil](javascript:alert(1)) `x`"
+	report.Sections = []*deepalert.Section{
+		{
+			Attr: deepalert.Attribute{Type: deepalert.TypeUserName, Key: "user", Value: "a`b"},
+			Users: []*deepalert.ContentUser{
+				{
+					Activities: []deepalert.EntityActivity{
+						{ServiceName: "svc", Target: "x | y\n# z", LastSeen: time.Now()},
+					},
+				},
+			},
+		},
+	}
+
+	buf, err := main.ReportToBody(report, main.BodyOptions{Branch: "main"})
+	require.NoError(t, err)
+	txt := buf.String()
+	if os.Getenv("VERBOSE") != "" {
+		fmt.Println(txt)
+	}
+
+	assert.Contains(t, txt, "- Reason: &lt;script&gt;alert(1)&lt;/script&gt;\n")
+	assert.NotContains(t, txt, "<script>")
+	assert.Contains(t, txt, "## User:  ``a`b`` \n")
+	assert.Contains(t, txt, "| svc |  |  |  |  `x \\| y # z`  |\n")
+
+	data, err := main.AlertToMarkdown(report.Alerts[0], main.BodyOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "# \\[blue\\] orange: evil\\](javascript:alert(1)) \\`x\\`\n")
+}
+
+func TestBodyDefuseUntrustedFields(t *testing.T) {
+	report := newTestReport()
+	report.Attributes = []*deepalert.Attribute{
+		{Type: deepalert.TypeIPAddr, Key: "@org/security-team #12", Value: "10.1.2.3"},
+	}
+	report.Sections = []*deepalert.Section{
+		{
+			Attr: deepalert.Attribute{Type: deepalert.TypeIPAddr, Key: "host", Value: "10.1.2.3"},
+			Hosts: []*deepalert.ContentHost{
+				{
+					Activities: []deepalert.EntityActivity{
+						{ServiceName: "@svc", Action: "see #3 @someone", LastSeen: time.Now()},
+					},
+					RelatedDomains: []deepalert.EntityDomain{
+						{Name: "example.com", Source: "@feed #4", Timestamp: time.Now()},
+					},
+					Software: []deepalert.EntitySoftware{
+						{Name: "@app", Location: "#5", LastSeen: time.Now()},
+					},
+				},
+			},
+		},
+	}
+
+	buf, err := main.ReportToBody(report, main.BodyOptions{Branch: "main"})
+	require.NoError(t, err)
+	txt := buf.String()
+
+	assert.Contains(t, txt, "- @\u200borg/security-team \\#\u200b12 ( `ipaddr` )")
+	assert.Contains(t, txt, "| @\u200bsvc |  |  | see \\#\u200b3 @\u200bsomeone |")
+	assert.Contains(t, txt, "| @\u200bfeed \\#\u200b4 |")
+	assert.Contains(t, txt, "| @\u200bapp | \\#\u200b5 |")
+
+	tmpl := `{{ heading 2 "@a" }}{{ bold "#1" }}{{ link "@b" "https://example.com" }}{{ table (list "@c") (list "#2") }}`
+	buf, err = main.ReportToBody(report, main.BodyOptions{Template: tmpl})
+	require.NoError(t, err)
+	txt = buf.String()
+	for _, s := range []string{"@a", "#1", "@b", "@c", "#2"} {
+		assert.NotContains(t, txt, s)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/deepalert/deepalert"
+	"github.com/deepalert/deepalert-github/src/md"
+)
+
+// maxBodyLength is limit of issue body length. GitHub rejects a larger body.
+const maxBodyLength = 65536
+
+// bodyLimit is a set of limits to shrink issue body
+type bodyLimit struct {
+	rows       int
+	codeLength int
+}
+
+// bodyLimits are tried in order until issue body fits in maxBodyLength
+var bodyLimits = []bodyLimit{
+	{rows: 100, codeLength: 8192},
+	{rows: 30, codeLength: 2048},
+	{rows: 10, codeLength: 512},
+	{rows: 3, codeLength: 128},
+}
+
+// truncatedBodyMark is appended if issue body is cut even with the smallest
+// limits
+const truncatedBodyMark = "\n\n... (truncated)\n\n"
+
+// fullBodyPath is a path of whole issue body committed to the alert archive
+// when the issue body is truncated
+func fullBodyPath(report deepalert.Report) string {
+	return reportToPath(report) + "issue_body_full.md"
+}
+
+func fullBodyCommitMessage(report deepalert.Report) string {
+	return fmt.Sprintf("[Issue] Full body of report %s", report.ID)
+}
+
+func fullBodyURL(report deepalert.Report, opt bodyOptions) string {
+	return fmt.Sprintf("../blob/%s/%s", opt.Branch, fullBodyPath(report))
+}
+
+// limitTableRows keeps rows of the table up to MaxRows and appends a row to
+// show number of omitted rows
+func limitTableRows(table *md.Table, opt bodyOptions) {
+	if opt.MaxRows <= 0 || len(table.Rows) <= opt.MaxRows {
+		return
+	}
+
+	omitted := len(table.Rows) - opt.MaxRows
+	note := md.TableRow{Cols: make([]md.TableCol, len(table.Haed.Cols))}
+	note.Cols[0] = md.TableCol{Content: md.ToLiteral(fmt.Sprintf("(%d more rows)", omitted))}
+	table.Rows = append(table.Rows[:opt.MaxRows], note)
+}
+
+// limitCode cuts code longer than MaxCodeLength
+func limitCode(code string, opt bodyOptions) string {
+	if opt.MaxCodeLength <= 0 || utf8.RuneCountInString(code) <= opt.MaxCodeLength {
+		return code
+	}
+	return string([]rune(code)[:opt.MaxCodeLength]) + "\n... (truncated)"
+}
+
+// buildIssueBody renders issue body with suffix that must be kept, e.g.
+// mentions and report marker. If the body exceeds maxBodyLength, tables and
+// code blocks are shrunk step by step and the body is cut at last. Then full
+// body without suffix is returned to be committed as fullBodyPath.
+func buildIssueBody(report deepalert.Report, opt bodyOptions, suffix string) (body, full string, err error) {
+	buf, err := reportToBody(report, opt)
+	if err != nil {
+		return "", "", err
+	}
+	full = buf.String()
+	if utf8.RuneCountInString(full+suffix) <= maxBodyLength {
+		return full + suffix, "", nil
+	}
+
+	header, err := renderString(
+		md.ToRaw("> "),
+		md.ToLiteral("Issue body is truncated because of size limit. See "),
+		&md.Link{Content: md.ToLiteral("full body"), URL: fullBodyURL(report, opt)},
+		md.ToRaw("\n\n"),
+	)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, limit := range bodyLimits {
+		opt.MaxRows, opt.MaxCodeLength = limit.rows, limit.codeLength
+		buf, err := reportToBody(report, opt)
+		if err != nil {
+			return "", "", err
+		}
+		body = header + buf.String()
+		if utf8.RuneCountInString(body+suffix) <= maxBodyLength {
+			return body + suffix, full, nil
+		}
+	}
+
+	logger.With("reportID", report.ID).With("length", utf8.RuneCountInString(body)).
+		Info("Issue body is too large even with smallest limits, then cut")
+	room := maxBodyLength - utf8.RuneCountInString(suffix+truncatedBodyMark)
+	for {
+		cut := cutBody(body, room)
+		// Mark and suffix must not be rendered in a code block or collapsed
+		closing := closeOpenBlocks(cut)
+		if utf8.RuneCountInString(cut+closing) <= room {
+			return cut + closing + truncatedBodyMark + suffix, full, nil
+		}
+		room -= utf8.RuneCountInString(closing)
+	}
+}
+
+// cutBody cuts body within room runes at end of a line not to break the last
+// line
+func cutBody(body string, room int) string {
+	if room <= 0 {
+		return ""
+	}
+	if runes := []rune(body); len(runes) > room {
+		body = string(runes[:room])
+	}
+	if i := strings.LastIndex(body, "\n"); i > 0 {
+		body = body[:i]
+	}
+	return body
+}
+
+// closeOpenBlocks returns lines to close a fenced code block and <details>
+// left open at end of body
+func closeOpenBlocks(body string) string {
+	var fence string
+	details := 0
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if fence != "" {
+			// Closing fence is fence characters only and not shorter than
+			// opening one
+			if len(line) >= len(fence) && strings.Trim(line, fence[:1]) == "" {
+				fence = ""
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "```"), strings.HasPrefix(line, "~~~"):
+			fence = line[:len(line)-len(strings.TrimLeft(line, line[:1]))]
+		case strings.HasPrefix(line, "<details"):
+			details++
+		case strings.HasPrefix(line, "</details>") && details > 0:
+			details--
+		}
+	}
+
+	var closing string
+	if fence != "" {
+		closing += "\n" + fence
+	}
+	closing += strings.Repeat("\n</details>", details)
+	return closing
+}
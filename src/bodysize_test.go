@@ -0,0 +1,128 @@
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/deepalert/deepalert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/deepalert/deepalert-github/src"
+)
+
+func newLargeReport(activities int) deepalert.Report {
+	report := newAlertReport(1)
+	report.Status = deepalert.StatusPublished
+	report.Result = deepalert.ReportResult{Severity: deepalert.SevUrgent, Reason: "large"}
+
+	user := &deepalert.ContentUser{}
+	for i := 0; i < activities; i++ {
+		user.Activities = append(user.Activities, deepalert.EntityActivity{
+			ServiceName: "svc",
+			Target:      fmt.Sprintf("target-%05d-%s", i, strings.Repeat("x", 100)),
+			LastSeen:    report.CreatedAt.Add(time.Duration(i) * time.Second),
+		})
+	}
+	report.Sections = []*deepalert.Section{
+		{Attr: deepalert.Attribute{Type: deepalert.TypeUserName, Key: "user", Value: "mizutani"}, Users: []*deepalert.ContentUser{user}},
+	}
+	return report
+}
+
+func publishLargeReport(t *testing.T, report deepalert.Report) (*main.FakeGithub, string) {
+	const repo = "blue/orange"
+	fake := main.NewFakeGithub()
+	fake.AddRepo(repo, "main", "oncall")
+
+	settings := newFakeSettings()
+	require.Empty(t, fake.HandleRecords(settings, []events.SQSMessage{toRecord(t, "large", report)}))
+
+	issues := fake.Issues(repo)
+	require.Equal(t, 1, len(issues))
+	return fake, issues[0].GetBody()
+}
+
+func TestBodySizeLimitTables(t *testing.T) {
+	report := newLargeReport(2000)
+	fake, body := publishLargeReport(t, report)
+
+	assert.LessOrEqual(t, utf8.RuneCountInString(body), 65536)
+	assert.True(t, strings.HasSuffix(body, main.ReportMarker(report.ID)+"\n"))
+	fullPath := "2021/01/02/" + string(report.ID) + "/issue_body_full.md"
+	assert.Contains(t, body, "See [full body](../blob/main/"+fullPath+")")
+	assert.Contains(t, body, "more rows) |")
+	// The latest activity is kept
+	assert.Contains(t, body, "target-01999-")
+
+	full := fake.Files("blue/orange", "main")[fullPath]
+	assert.Contains(t, full, "target-00000-")
+	assert.Contains(t, full, "target-01999-")
+	assert.NotContains(t, full, "more rows")
+}
+
+func TestBodySizeLimitCut(t *testing.T) {
+	report := newLargeReport(0)
+	report.Result.Reason = strings.Repeat("long reason ", 7000)
+	fake, body := publishLargeReport(t, report)
+
+	assert.LessOrEqual(t, utf8.RuneCountInString(body), 65536)
+	assert.Contains(t, body, "... (truncated)\n\n"+main.ReportMarker(report.ID)+"\n")
+
+	full := fake.Files("blue/orange", "main")["2021/01/02/"+string(report.ID)+"/issue_body_full.md"]
+	assert.Contains(t, full, report.Result.Reason)
+}
+
+func TestBodySizeLimitCutInCodeBlock(t *testing.T) {
+	report := newLargeReport(0)
+	value := `{"data":"` + strings.Repeat("x", 200) + `"}`
+	for i := 0; i < 600; i++ {
+		report.Attributes = append(report.Attributes, &deepalert.Attribute{
+			Type: deepalert.TypeJSON, Key: fmt.Sprintf("json%03d", i), Value: value,
+		})
+	}
+	settings := newFakeSettings()
+	fake := main.NewFakeGithub()
+	fake.AddRepo("blue/orange", "main")
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"github_assign_rules": [{"severity":"urgent","mentions":["org/sec"]}]
+	}`), &settings))
+	require.Empty(t, fake.HandleRecords(settings, []events.SQSMessage{toRecord(t, "large", report)}))
+	issues := fake.Issues("blue/orange")
+	require.Equal(t, 1, len(issues))
+	body := issues[0].GetBody()
+
+	assert.LessOrEqual(t, utf8.RuneCountInString(body), 65536)
+	assert.True(t, strings.HasSuffix(body, main.ReportMarker(report.ID)+"\n"))
+	assert.Contains(t, body, "\n```\n\n... (truncated)\n\ncc: @org/sec\n")
+
+	// Mark, mentions and marker are out of code block and collapsed section
+	var fences int
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "```") {
+			fences++
+		}
+	}
+	assert.Equal(t, 0, fences%2)
+	assert.Equal(t, strings.Count(body, "<details>"), strings.Count(body, "</details>"))
+}
+
+func TestCloseOpenBlocks(t *testing.T) {
+	assert.Equal(t, "", main.CloseOpenBlocks("text\n```json\n{}\n```\n<details>\n\n</details>"))
+	assert.Equal(t, "\n```", main.CloseOpenBlocks("text\n```json\n{"))
+	assert.Equal(t, "\n````", main.CloseOpenBlocks("````json\n```\n"))
+	assert.Equal(t, "\n```\n</details>", main.CloseOpenBlocks("<details><summary>Raw</summary>\n\n```json\n[\n  \"<details>\""))
+}
+
+func TestBodySizeLimitNotExceeded(t *testing.T) {
+	report := newLargeReport(10)
+	fake, body := publishLargeReport(t, report)
+
+	assert.NotContains(t, body, "full body")
+	assert.NotContains(t, fake.Files("blue/orange", "main"), "2021/01/02/"+string(report.ID)+"/issue_body_full.md")
+}
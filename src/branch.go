@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/go-github/v27/github"
+	"github.com/m-mizutani/golambda"
+)
+
+// resolveBranch returns a branch name to store alert files. The configured
+// branch is created from the default branch if it does not exist. If no
+// branch is configured, default branch of the repository is used.
+func resolveBranch(ctx context.Context, client *github.Client, owner, repo, configured string) (string, error) {
+	if configured != "" {
+		_, resp, err := client.Repositories.GetBranch(ctx, owner, repo, configured)
+		if err == nil {
+			return configured, nil
+		}
+		if resp == nil || resp.StatusCode != http.StatusNotFound {
+			return "", wrapGithubError(err, "Failed to get branch", resp).
+				With("owner", owner).
+				With("repo", repo).
+				With("branch", configured)
+		}
+	}
+
+	repository, resp, err := client.Repositories.Get(ctx, owner, repo)
+	if err != nil {
+		return "", wrapGithubError(err, "Failed to get repository", resp).
+			With("owner", owner).
+			With("repo", repo)
+	}
+	defaultBranch := repository.GetDefaultBranch()
+	if defaultBranch == "" {
+		return "", golambda.NewError("Repository has no default branch").
+			With("owner", owner).
+			With("repo", repo)
+	}
+
+	if configured == "" || configured == defaultBranch {
+		return defaultBranch, nil
+	}
+
+	base, resp, err := client.Repositories.GetBranch(ctx, owner, repo, defaultBranch)
+	if err != nil {
+		return "", wrapGithubError(err, "Failed to get default branch", resp).
+			With("owner", owner).
+			With("repo", repo).
+			With("branch", defaultBranch)
+	}
+
+	ref := &github.Reference{
+		Ref:    github.String("refs/heads/" + configured),
+		Object: &github.GitObject{SHA: base.GetCommit().SHA},
+	}
+	if _, resp, err := client.Git.CreateRef(ctx, owner, repo, ref); err != nil {
+		// 422 means the branch has been created by other process
+		if resp == nil || resp.StatusCode != http.StatusUnprocessableEntity {
+			return "", wrapGithubError(err, "Failed to create branch", resp).
+				With("owner", owner).
+				With("repo", repo).
+				With("branch", configured)
+		}
+	} else {
+		logger.With("branch", configured).With("base", defaultBranch).Info("Created branch for alert files")
+	}
+
+	return configured, nil
+}
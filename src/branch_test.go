@@ -0,0 +1,66 @@
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/deepalert/deepalert-github/src"
+)
+
+func TestResolveBranch(t *testing.T) {
+	t.Run("default branch", func(t *testing.T) {
+		mux := http.NewServeMux()
+		handleRepository(mux, "blue/orange", "main")
+
+		branch, err := main.ResolveBranch(newTestClient(t, mux), "blue", "orange", "")
+		require.NoError(t, err)
+		assert.Equal(t, "main", branch)
+	})
+
+	t.Run("existing branch", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/repos/blue/orange/branches/alerts", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"name":"alerts","commit":{"sha":"abc"}}`)
+		})
+
+		branch, err := main.ResolveBranch(newTestClient(t, mux), "blue", "orange", "alerts")
+		require.NoError(t, err)
+		assert.Equal(t, "alerts", branch)
+	})
+
+	t.Run("create missing branch", func(t *testing.T) {
+		var ref struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		}
+		mux := http.NewServeMux()
+		handleRepository(mux, "blue/orange", "main")
+		mux.HandleFunc("/repos/blue/orange/branches/alerts", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"Branch not found"}`)
+		})
+		mux.HandleFunc("/repos/blue/orange/branches/main", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"name":"main","commit":{"sha":"0123abcd"}}`)
+		})
+		mux.HandleFunc("/repos/blue/orange/git/refs", func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "POST", r.Method)
+			if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&ref)) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{}`)
+		})
+
+		branch, err := main.ResolveBranch(newTestClient(t, mux), "blue", "orange", "alerts")
+		require.NoError(t, err)
+		assert.Equal(t, "alerts", branch)
+		assert.Equal(t, "refs/heads/alerts", ref.Ref)
+		assert.Equal(t, "0123abcd", ref.SHA)
+	})
+}
@@ -7,7 +7,7 @@ import (
 	"github.com/deepalert/deepalert-github/src/md"
 )
 
-func buildActivitiesSection(activities []deepalert.EntityActivity) (nodes []md.Node) {
+func buildActivitiesSection(activities []deepalert.EntityActivity, opt bodyOptions) (nodes []md.Node) {
 	if len(activities) == 0 {
 		return
 	}
@@ -30,18 +30,21 @@ func buildActivitiesSection(activities []deepalert.EntityActivity) (nodes []md.N
 	})
 
 	for _, act := range activities {
+		addrType, addr := remoteAddrType(act.RemoteAddr)
 		table.Rows = append(table.Rows, md.TableRow{
 			Cols: []md.TableCol{
 				{Content: md.ToLiteral(act.LastSeen.Format(timeFormat))},
-				{Content: md.ToLiteral(act.ServiceName)},
-				{Content: md.ToLiteral(act.RemoteAddr)},
-				{Content: md.ToLiteral(act.Principal)},
-				{Content: md.ToLiteral(act.Action)},
-				{Content: md.ToLiteral(act.Target)},
+				{Content: md.ToText(act.ServiceName)},
+				{Content: append(md.Contents{toCodeOrEmpty(opt.defang(act.RemoteAddr, defangText))},
+					buildEnrichLinks(addrType, "", addr, opt)...)},
+				{Content: toCodeOrEmpty(act.Principal)},
+				{Content: md.ToText(act.Action)},
+				{Content: toCodeOrEmpty(opt.defang(act.Target, defangText))},
 			},
 		})
 	}
 
+	limitTableRows(&table, opt)
 	nodes = append(nodes, []md.Node{
 		&md.Heading{Level: 3, Content: md.ToLiteral("Activities")},
 		&table,
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v27/github"
+	"github.com/m-mizutani/golambda"
+)
+
+// secretTTL is lifetime of cached secret values. The secret is fetched again
+// after the TTL to follow secret rotation.
+const secretTTL = 5 * time.Minute
+
+// clientCache keeps secret values and GitHub client across records and warm
+// invocations of the Lambda container. An installation token of GitHub App is
+// refreshed by ghinstallation transport in the cached client when it expires.
+type clientCache struct {
+	mutex sync.Mutex
+	now   func() time.Time
+
+	secretARN string
+	settings  *githubSettings
+	fetchedAt time.Time
+
+	client      *github.Client
+	credentials clientCredentials
+}
+
+func newClientCache() *clientCache {
+	return &clientCache{now: time.Now}
+}
+
+var defaultClientCache = newClientCache()
+
+func (x *clientCache) getSettings(secretARN string, factory golambda.SecretsManagerFactory) (githubSettings, error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if x.settings != nil && x.secretARN == secretARN && x.now().Before(x.fetchedAt.Add(secretTTL)) {
+		return *x.settings, nil
+	}
+
+	var settings githubSettings
+	if err := golambda.GetSecretValuesWithFactory(secretARN, &settings, factory); err != nil {
+		return githubSettings{}, err
+	}
+	logger.With("secretARN", secretARN).Debug("Fetched secret values")
+
+	x.secretARN = secretARN
+	x.settings = &settings
+	x.fetchedAt = x.now()
+
+	return settings, nil
+}
+
+// clientCredentials is a set of fields to build a client. A cached client is
+// used only if its credentials are same with current settings.
+type clientCredentials struct {
+	endpoint   string
+	appID      string
+	installID  string
+	privateKey string
+	token      string
+}
+
+func credentialsOf(settings githubSettings) clientCredentials {
+	return clientCredentials{
+		endpoint:   settings.GithubEndpoint,
+		appID:      settings.GithubAppID,
+		installID:  settings.GithubInstallID,
+		privateKey: settings.GithubPrivateKey,
+		token:      settings.GithubToken,
+	}
+}
+
+func (x *clientCache) getClient(settings githubSettings) (*github.Client, error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	credentials := credentialsOf(settings)
+	if x.client != nil && x.credentials == credentials {
+		return x.client, nil
+	}
+
+	client, err := settings.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	x.client = client
+	x.credentials = credentials
+	return client, nil
+}
+
+// invalidate drops cached secret values and client. Then both are created
+// again from the latest secret at next call.
+func (x *clientCache) invalidate() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	x.settings = nil
+	x.client = nil
+	x.credentials = clientCredentials{}
+}
+
+// isAuthError returns true if GitHub rejects credentials, e.g. the secret has
+// been rotated or the installation has been removed.
+func isAuthError(err error) bool {
+	var ghErr *github.ErrorResponse
+	if errors.As(err, &ghErr) && ghErr.Response != nil {
+		return ghErr.Response.StatusCode == http.StatusUnauthorized
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package main_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/golambda"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/deepalert/deepalert-github/src"
+)
+
+func TestClientCache(t *testing.T) {
+	const secretARN = "arn:aws:secretsmanager:us-east-1:111122223333:secret:test"
+	mock, factory := golambda.NewSecretsManagerMock()
+	mock.Secrets[secretARN] = `{"github_token":"xxx"}`
+
+	now := time.Now()
+	cache := main.NewClientCache(func() time.Time { return now })
+
+	t.Run("secret is fetched once in TTL", func(t *testing.T) {
+		s1, err := cache.GetSettings(secretARN, factory)
+		require.NoError(t, err)
+		s2, err := cache.GetSettings(secretARN, factory)
+		require.NoError(t, err)
+		assert.Equal(t, "xxx", s1.GithubToken)
+		assert.Equal(t, s1, s2)
+		assert.Equal(t, 1, len(mock.Input))
+	})
+
+	t.Run("client is reused with same credentials", func(t *testing.T) {
+		settings, err := cache.GetSettings(secretARN, factory)
+		require.NoError(t, err)
+		c1, err := cache.GetClient(settings)
+		require.NoError(t, err)
+		c2, err := cache.GetClient(settings)
+		require.NoError(t, err)
+		assert.Same(t, c1, c2)
+	})
+
+	t.Run("rotated secret is fetched after TTL", func(t *testing.T) {
+		settings, err := cache.GetSettings(secretARN, factory)
+		require.NoError(t, err)
+		c1, err := cache.GetClient(settings)
+		require.NoError(t, err)
+
+		mock.Secrets[secretARN] = `{"github_token":"yyy"}`
+		now = now.Add(10 * time.Minute)
+
+		settings, err = cache.GetSettings(secretARN, factory)
+		require.NoError(t, err)
+		assert.Equal(t, "yyy", settings.GithubToken)
+		assert.Equal(t, 2, len(mock.Input))
+
+		c2, err := cache.GetClient(settings)
+		require.NoError(t, err)
+		assert.NotSame(t, c1, c2)
+	})
+
+	t.Run("invalidate drops cache", func(t *testing.T) {
+		cache.Invalidate()
+		_, err := cache.GetSettings(secretARN, factory)
+		require.NoError(t, err)
+		assert.Equal(t, 3, len(mock.Input))
+	})
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/deepalert/deepalert"
+	"github.com/m-mizutani/golambda"
+)
+
+// renderInput accepts SQS event, SNS event and SNS message. Other JSON is
+// handled as a report.
+type renderInput struct {
+	Records []struct {
+		Body string            `json:"body"`
+		SNS  *events.SNSEntity `json:"Sns"`
+	} `json:"Records"`
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+func parseRenderInput(data []byte) ([]deepalert.Report, error) {
+	var input renderInput
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, golambda.WrapError(err, "Failed to parse input as JSON")
+	}
+
+	var reports []deepalert.Report
+	switch {
+	case len(input.Records) > 0:
+		for _, record := range input.Records {
+			var report deepalert.Report
+			var err error
+			if record.SNS != nil {
+				err = golambda.EventRecord(record.SNS.Message).Bind(&report)
+			} else {
+				report, err = recordToReport(events.SQSMessage{Body: record.Body})
+			}
+			if err != nil {
+				return nil, err
+			}
+			reports = append(reports, report)
+		}
+
+	case input.Type == "Notification":
+		var report deepalert.Report
+		if err := golambda.EventRecord(input.Message).Bind(&report); err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+
+	default:
+		var report deepalert.Report
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil, golambda.WrapError(err, "Failed to parse input as report")
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// renderReport builds issue title, issue body and alert files as same as
+// publishToGithub without GitHub API. Paths of title and body are placed in
+// the report directory of alert archive.
+func renderReport(report deepalert.Report, settings githubSettings, branch string) ([]archiveFile, error) {
+	if len(report.Alerts) == 0 {
+		return nil, golambda.NewError("Report has no alert").With("reportID", report.ID)
+	}
+
+	// Report ID is a part of output path and must not escape the directory
+	id := string(report.ID)
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		return nil, golambda.NewError("Invalid report ID for output path").With("reportID", report.ID)
+	}
+
+	content, err := buildIssueContent(report, settings, branch)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := reportToPath(report)
+	files := []archiveFile{
+		{Path: dir + "issue_title.txt", Data: []byte(content.Title + "\n")},
+		{Path: dir + "issue_body.md", Data: []byte(content.Body)},
+	}
+	if content.FullBody != "" {
+		files = append(files, archiveFile{Path: fullBodyPath(report), Data: []byte(content.FullBody)})
+	}
+
+	for _, alert := range report.Alerts {
+		path, err := alertToPath(report, alert)
+		if err != nil {
+			return nil, err
+		}
+		data, err := alertToMarkdown(alert, settings.bodyOptions(branch))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, archiveFile{Path: path, Data: data})
+	}
+
+	return files, nil
+}
+
+// renderCommand renders reports in a file (or stdin) to stdout or a directory.
+//
+//	go run ./src render [-branch main] [-title '{{ .ID }}'] [-template body.tmpl] [-defang] [-links links.json] [-o outdir] [report.json|-]
+func renderCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	branch := flags.String("branch", "main", "Branch name of alert files linked from issue body")
+	outDir := flags.String("o", "", "Output directory. Rendered files are printed to stdout if not set")
+	tmplPath := flags.String("template", "", "File path of issue body template (text/template)")
+	titleTmpl := flags.String("title", "", "Issue title template (text/template)")
+	defang := flags.Bool("defang", false, "Defang IP address, domain name and URL")
+	linksPath := flags.String("links", "", "File path of enrich links (JSON map from attribute type to links)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	input := stdin
+	if flags.NArg() > 0 && flags.Arg(0) != "-" {
+		fd, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return golambda.WrapError(err, "Failed to open input").With("path", flags.Arg(0))
+		}
+		defer fd.Close()
+		input = fd
+	}
+
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		return golambda.WrapError(err, "Failed to read input")
+	}
+
+	reports, err := parseRenderInput(data)
+	if err != nil {
+		return err
+	}
+
+	settings := githubSettings{GithubTitleTemplate: *titleTmpl, GithubDefang: *defang}
+	if *tmplPath != "" {
+		raw, err := ioutil.ReadFile(*tmplPath)
+		if err != nil {
+			return golambda.WrapError(err, "Failed to read template").With("path", *tmplPath)
+		}
+		settings.GithubBodyTemplate = string(raw)
+	}
+	if *linksPath != "" {
+		raw, err := ioutil.ReadFile(*linksPath)
+		if err != nil {
+			return golambda.WrapError(err, "Failed to read enrich links").With("path", *linksPath)
+		}
+		if err := json.Unmarshal(raw, &settings.GithubEnrichLinks); err != nil {
+			return golambda.WrapError(err, "Failed to parse enrich links").With("path", *linksPath)
+		}
+	}
+
+	for _, report := range reports {
+		files, err := renderReport(report, settings, *branch)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			if *outDir == "" {
+				fmt.Fprintf(stdout, "==> %s <==\n%s\n", file.Path, file.Data)
+				continue
+			}
+
+			path := filepath.Join(*outDir, filepath.FromSlash(file.Path))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return golambda.WrapError(err, "Failed to create output directory").With("path", path)
+			}
+			if err := ioutil.WriteFile(path, file.Data, 0644); err != nil {
+				return golambda.WrapError(err, "Failed to write output").With("path", path)
+			}
+			fmt.Fprintln(stdout, path)
+		}
+	}
+
+	return nil
+}
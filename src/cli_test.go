@@ -0,0 +1,88 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/deepalert/deepalert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/deepalert/deepalert-github/src"
+)
+
+func TestRenderCommand(t *testing.T) {
+	report := newAlertReport(2)
+	raw, err := json.Marshal(report)
+	require.NoError(t, err)
+	alertPath, err := main.AlertToPath(report, report.Alerts[0])
+	require.NoError(t, err)
+
+	t.Run("report JSON from stdin", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		require.NoError(t, main.RenderCommand([]string{"-branch", "alerts"}, bytes.NewReader(raw), out))
+		assert.Contains(t, out.String(), "==> 2021/01/02/"+string(report.ID)+"/issue_title.txt <==\n[blue] orange: alert 0\n")
+		assert.Contains(t, out.String(), "../tree/alerts/2021/01/02/"+string(report.ID)+"/")
+		assert.Contains(t, out.String(), "==> "+alertPath+" <==\n")
+	})
+
+	t.Run("SQS event to directory", func(t *testing.T) {
+		body, err := json.Marshal(events.SNSEntity{Type: "Notification", Message: string(raw)})
+		require.NoError(t, err)
+		event, err := json.Marshal(events.SQSEvent{Records: []events.SQSMessage{{Body: string(body)}}})
+		require.NoError(t, err)
+
+		dir := t.TempDir()
+		input := filepath.Join(dir, "event.json")
+		require.NoError(t, ioutil.WriteFile(input, event, 0644))
+		outDir := filepath.Join(dir, "out")
+
+		out := new(bytes.Buffer)
+		require.NoError(t, main.RenderCommand([]string{"-o", outDir, input}, nil, out))
+		assert.Equal(t, 4, len(strings.Split(strings.TrimSpace(out.String()), "\n")))
+
+		data, err := ioutil.ReadFile(filepath.Join(outDir, filepath.FromSlash(alertPath)))
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "alert 0")
+
+		data, err = ioutil.ReadFile(filepath.Join(outDir, "2021", "01", "02", string(report.ID), "issue_body.md"))
+		require.NoError(t, err)
+		assert.Contains(t, string(data), main.ReportMarker(report.ID))
+	})
+
+	t.Run("SNS event", func(t *testing.T) {
+		event, err := json.Marshal(events.SNSEvent{Records: []events.SNSEventRecord{
+			{SNS: events.SNSEntity{Message: string(raw)}},
+		}})
+		require.NoError(t, err)
+
+		out := new(bytes.Buffer)
+		require.NoError(t, main.RenderCommand(nil, bytes.NewReader(event), out))
+		assert.Contains(t, out.String(), "[blue] orange: alert 0")
+	})
+
+	t.Run("report ID escaping output directory", func(t *testing.T) {
+		dir := t.TempDir()
+		for _, id := range []string{"../../x", `a\b`, "a/b", ".."} {
+			r := newAlertReport(1)
+			r.ID = deepalert.ReportID(id)
+			raw, err := json.Marshal(r)
+			require.NoError(t, err)
+			err = main.RenderCommand([]string{"-o", filepath.Join(dir, "out")}, bytes.NewReader(raw), new(bytes.Buffer))
+			assert.Error(t, err, id)
+		}
+		files, err := ioutil.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, files)
+	})
+
+	t.Run("report without alert", func(t *testing.T) {
+		err := main.RenderCommand(nil, strings.NewReader(`{"id":"x"}`), new(bytes.Buffer))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/deepalert/deepalert"
+	"github.com/deepalert/deepalert-github/src/md"
+)
+
+// defangSchemes replaces URL schemes not to be clicked, e.g. hxxp://
+var defangSchemes = map[string]string{
+	"http":  "hxxp",
+	"https": "hxxps",
+	"ftp":   "fxp",
+}
+
+// domainPattern matches a host name that has TLD starting with a letter.
+// Version numbers such as 1.2.3 are not matched.
+var domainPattern = regexp.MustCompile(`^([A-Za-z0-9_-]+\.)+[A-Za-z][A-Za-z0-9-]*\.?$`)
+
+// defangIPAddr replaces the last dot of IPv4 address (10.0.0[.]1) or all
+// colons of IPv6 address (2001[:]db8[:][:]1)
+func defangIPAddr(s string) string {
+	ip := net.ParseIP(s)
+	switch {
+	case ip == nil:
+		return defangText(s)
+	case ip.To4() != nil:
+		i := strings.LastIndex(s, ".")
+		return s[:i] + "[.]" + s[i+1:]
+	default:
+		return strings.ReplaceAll(s, ":", "[:]")
+	}
+}
+
+// defangDomain replaces all dots of domain name, e.g. evil[.]example[.]com
+func defangDomain(s string) string {
+	return strings.ReplaceAll(s, ".", "[.]")
+}
+
+// defangURL replaces scheme and dots of host in URL, e.g.
+// hxxp://evil[.]example[.]com/path. Path and query are kept as they are.
+func defangURL(s string) string {
+	scheme, rest := "", s
+	if i := strings.Index(s, "://"); i >= 0 {
+		scheme, rest = s[:i], s[i+3:]
+		if replaced, ok := defangSchemes[strings.ToLower(scheme)]; ok {
+			scheme = replaced
+		}
+		scheme += "://"
+	}
+
+	end := strings.IndexAny(rest, "/?#")
+	if end < 0 {
+		end = len(rest)
+	}
+	return scheme + defangDomain(rest[:end]) + rest[end:]
+}
+
+// defangText defangs a value of unknown type such as remote address and
+// target of activity. Only URL, IP address (with port) and domain name are
+// changed.
+func defangText(s string) string {
+	if strings.Contains(s, "://") {
+		return defangURL(s)
+	}
+
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		host, port = s, ""
+	}
+
+	var defanged string
+	switch {
+	case net.ParseIP(host) != nil:
+		defanged = defangIPAddr(host)
+	case domainPattern.MatchString(host):
+		defanged = defangDomain(host)
+	default:
+		return s
+	}
+
+	if port != "" {
+		return net.JoinHostPort(defanged, port)
+	}
+	return defanged
+}
+
+// defangAttr defangs value of IP address, domain name and URL attribute
+func defangAttr(attr *deepalert.Attribute) string {
+	switch attr.Type {
+	case deepalert.TypeIPAddr:
+		return defangIPAddr(attr.Value)
+	case deepalert.TypeDomainName:
+		return defangDomain(attr.Value)
+	case deepalert.TypeURL:
+		return defangURL(attr.Value)
+	default:
+		return attr.Value
+	}
+}
+
+// defang applies f to s only if defang mode is enabled
+func (x bodyOptions) defang(s string, f func(string) string) string {
+	if !x.Defang {
+		return s
+	}
+	return f(s)
+}
+
+// defangAll applies f to all values if defang mode is enabled
+func defangAll(values []string, f func(string) string, opt bodyOptions) []string {
+	if !opt.Defang {
+		return values
+	}
+	defanged := make([]string, len(values))
+	for i, v := range values {
+		defanged[i] = f(v)
+	}
+	return defanged
+}
+
+// attrValue returns attribute value to be rendered
+func (x bodyOptions) attrValue(attr *deepalert.Attribute) string {
+	if !x.Defang {
+		return attr.Value
+	}
+	return defangAttr(attr)
+}
+
+// rawValues collects original values changed by defang for the raw section
+type rawValues struct {
+	values []string
+	seen   map[string]struct{}
+}
+
+func (x *rawValues) add(original, defanged string) {
+	if original == defanged {
+		return
+	}
+	if x.seen == nil {
+		x.seen = map[string]struct{}{}
+	}
+	if _, ok := x.seen[original]; ok {
+		return
+	}
+	x.seen[original] = struct{}{}
+	x.values = append(x.values, original)
+}
+
+func (x *rawValues) addAttr(attr *deepalert.Attribute) {
+	x.add(attr.Value, defangAttr(attr))
+}
+
+func (x *rawValues) addActivities(activities []deepalert.EntityActivity) {
+	for _, act := range activities {
+		x.add(act.RemoteAddr, defangText(act.RemoteAddr))
+		x.add(act.Target, defangText(act.Target))
+	}
+}
+
+// reportRawValues returns original values of defanged values in issue body
+func reportRawValues(report deepalert.Report) []string {
+	var raw rawValues
+	for _, attr := range report.Attributes {
+		raw.addAttr(attr)
+	}
+
+	for _, section := range report.Sections {
+		raw.addAttr(&section.Attr)
+		for _, host := range section.Hosts {
+			for _, addr := range host.IPAddr {
+				raw.add(addr, defangIPAddr(addr))
+			}
+			raw.addActivities(host.Activities)
+			for _, domain := range host.RelatedDomains {
+				raw.add(domain.Name, defangDomain(domain.Name))
+			}
+			for _, url := range host.RelatedURLs {
+				raw.add(url.URL, defangURL(url.URL))
+			}
+		}
+		for _, user := range section.Users {
+			raw.addActivities(user.Activities)
+		}
+		for _, binary := range section.Binaries {
+			raw.addActivities(binary.Activities)
+		}
+	}
+
+	return raw.values
+}
+
+// alertRawValues returns original values of defanged attributes in alert file
+func alertRawValues(alert *deepalert.Alert) []string {
+	var raw rawValues
+	for i := range alert.Attributes {
+		raw.addAttr(&alert.Attributes[i])
+	}
+	return raw.values
+}
+
+// buildRawSection renders original values as JSON array in a collapsed
+// section. Values in code block are neither linked nor changed by GitHub.
+func buildRawSection(values []string, opt bodyOptions) []md.Node {
+	if !opt.Defang || len(values) == 0 {
+		return nil
+	}
+
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	// Encoding []string never fails
+	_ = enc.Encode(values)
+
+	return []md.Node{
+		md.ToRaw("<details><summary>Raw values (not defanged)</summary>\n\n"),
+		md.ToCodeBlock(strings.TrimSuffix(buf.String(), "\n")),
+		md.ToRaw("\n</details>\n\n"),
+	}
+}
@@ -0,0 +1,95 @@
+package main_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/deepalert/deepalert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/deepalert/deepalert-github/src"
+)
+
+func TestDefangText(t *testing.T) {
+	testCases := map[string]string{
+		"10.2.3.4":                     "10.2.3[.]4",
+		"10.2.3.4:443":                 "10.2.3[.]4:443",
+		"2001:db8::1":                  "2001[:]db8[:][:]1",
+		"evil.example.com":             "evil[.]example[.]com",
+		"https://evil.example.com/a.b": "hxxps://evil[.]example[.]com/a.b",
+		"/usr/bin/ls":                  "/usr/bin/ls",
+		"version 1.2.3":                "version 1.2.3",
+	}
+	for input, expected := range testCases {
+		assert.Equal(t, expected, main.DefangText(input), input)
+	}
+}
+
+func newDefangReport() deepalert.Report {
+	report := newTestReport()
+	report.Attributes = []*deepalert.Attribute{
+		{Type: deepalert.TypeIPAddr, Key: "remote", Value: "198.51.100.1"},
+		{Type: deepalert.TypeURL, Key: "url", Value: "http://evil.example.com/x", Context: deepalert.AttrContexts{deepalert.CtxAdditionalInfo}},
+	}
+	report.Alerts[0].Attributes = []deepalert.Attribute{
+		{Type: deepalert.TypeDomainName, Key: "domain", Value: "evil.example.com"},
+	}
+	report.Sections = []*deepalert.Section{
+		{
+			Attr: deepalert.Attribute{Type: deepalert.TypeIPAddr, Key: "remote", Value: "198.51.100.1"},
+			Hosts: []*deepalert.ContentHost{
+				{
+					IPAddr:         []string{"198.51.100.1"},
+					RelatedDomains: []deepalert.EntityDomain{{Name: "c2.example.net", Timestamp: time.Now()}},
+					RelatedURLs:    []deepalert.EntityURL{{URL: "https://c2.example.net/gate", Timestamp: time.Now()}},
+					Activities: []deepalert.EntityActivity{
+						{ServiceName: "proxy", RemoteAddr: "203.0.113.5:8080", Target: "c2.example.net", LastSeen: time.Now()},
+					},
+				},
+			},
+		},
+	}
+	return report
+}
+
+func TestBodyDefang(t *testing.T) {
+	report := newDefangReport()
+
+	buf, err := main.ReportToBody(report, main.BodyOptions{Branch: "main", Defang: true})
+	require.NoError(t, err)
+	txt := buf.String()
+	if os.Getenv("VERBOSE") != "" {
+		fmt.Println(txt)
+	}
+
+	assert.Contains(t, txt, "- remote ( `ipaddr` ):  `198.51.100[.]1` \n")
+	assert.Contains(t, txt, "- url `hxxp://evil[.]example[.]com/x` \n")
+	assert.NotContains(t, txt, "](http://evil.example.com/x)")
+	assert.Contains(t, txt, "## Host:  `198.51.100[.]1` \n")
+	assert.Contains(t, txt, "|  `c2[.]example[.]net`  |  |\n")
+	assert.Contains(t, txt, "|  `hxxps://c2[.]example[.]net/gate`  |")
+	assert.Contains(t, txt, "| proxy |  `203.0.113[.]5:8080`  |  |  |  `c2[.]example[.]net`  |\n")
+
+	// Original values are kept in code block of collapsed section
+	assert.Contains(t, txt, "<details><summary>Raw values (not defanged)</summary>\n\n")
+	assert.Contains(t, txt, `"http://evil.example.com/x",`)
+	assert.Contains(t, txt, `"203.0.113.5:8080",`)
+
+	// Not defanged by default
+	buf, err = main.ReportToBody(report, main.BodyOptions{Branch: "main"})
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "- remote ( `ipaddr` ):  `198.51.100.1` \n")
+	assert.NotContains(t, buf.String(), "<details>")
+}
+
+func TestAlertDefang(t *testing.T) {
+	report := newDefangReport()
+
+	data, err := main.AlertToMarkdown(report.Alerts[0], main.BodyOptions{Defang: true})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "- domain ( `domain` ):  `evil[.]example[.]com` \n")
+	assert.Contains(t, string(data), "[\n  \"evil.example.com\"\n]")
+}
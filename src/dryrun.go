@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+
+	"github.com/deepalert/deepalert"
+	"github.com/google/go-github/v27/github"
+)
+
+// dryRunOperation is a GitHub operation that would be done by the report
+type dryRunOperation struct {
+	Action    string   `json:"action"`
+	Repo      string   `json:"repo,omitempty"`
+	Repos     []string `json:"repos,omitempty"`
+	Branch    string   `json:"branch,omitempty"`
+	Paths     []string `json:"paths,omitempty"`
+	Message   string   `json:"message,omitempty"`
+	Title     string   `json:"title,omitempty"`
+	Labels    []string `json:"labels,omitempty"`
+	Assignees []string `json:"assignees,omitempty"`
+	Milestone int      `json:"milestone,omitempty"`
+	Column    int64    `json:"project_column_id,omitempty"`
+	Body      string   `json:"body,omitempty"`
+}
+
+// dryRunPublisher is reportPublisher that logs and records operations instead
+// of calling GitHub API. Files and issue are built as same as githubPublisher
+// except ones requiring current state of the repository, e.g. index files of
+// the archive and existing issue.
+type dryRunPublisher struct {
+	operations []dryRunOperation
+}
+
+// dryRunBranch is used for links in issue body if branch is not configured
+// because default branch can not be retrieved without API. GitHub resolves
+// HEAD to the default branch.
+const dryRunBranch = "HEAD"
+
+// dryRunBranchOf returns the branch recorded in every operation and used for
+// links, so that they are consistent when branch is not configured.
+func dryRunBranchOf(settings githubSettings) string {
+	if settings.GithubBranch == "" {
+		return dryRunBranch
+	}
+	return settings.GithubBranch
+}
+
+func (x *dryRunPublisher) record(op dryRunOperation) {
+	x.operations = append(x.operations, op)
+	logger.With("operation", op).Info("Dry run, GitHub API is not called")
+}
+
+func (x *dryRunPublisher) publishAlert(ctx context.Context, report deepalert.Report, settings githubSettings) (string, error) {
+	if len(report.Alerts) == 0 {
+		return "", nil
+	}
+
+	if _, _, err := splitRepo(settings.GithubRepo); err != nil {
+		return "", err
+	}
+
+	alertFiles, jsonFiles, err := buildArchiveFiles(report, settings)
+	if err != nil {
+		return "", err
+	}
+
+	var paths []string
+	for _, file := range append(alertFiles, jsonFiles...) {
+		paths = append(paths, file.Path)
+	}
+	paths = append(paths, reportIndexPath(report), dailyIndexPath(report))
+
+	x.record(dryRunOperation{
+		Action:  "commit_files",
+		Repo:    settings.GithubRepo,
+		Branch:  dryRunBranchOf(settings),
+		Paths:   paths,
+		Message: alertCommitMessage(report),
+	})
+
+	return reportToPath(report), nil
+}
+
+func (x *dryRunPublisher) publishReport(ctx context.Context, report deepalert.Report, settings githubSettings) (*github.Issue, error) {
+	if _, _, err := splitRepo(settings.GithubRepo); err != nil {
+		return nil, err
+	}
+
+	branch := dryRunBranchOf(settings)
+
+	content, err := buildIssueContent(report, settings, branch)
+	if err != nil {
+		return nil, err
+	}
+
+	if content.FullBody != "" {
+		x.record(dryRunOperation{
+			Action:  "commit_files",
+			Repo:    settings.GithubRepo,
+			Branch:  branch,
+			Paths:   []string{fullBodyPath(report)},
+			Message: fullBodyCommitMessage(report),
+		})
+	}
+
+	x.record(dryRunOperation{
+		Action:    "publish_issue",
+		Repo:      settings.GithubRepo,
+		Branch:    branch,
+		Title:     content.Title,
+		Labels:    content.Labels,
+		Assignees: content.Placement.Assignees,
+		Milestone: content.Placement.Milestone,
+		Column:    content.Placement.ProjectColumnID,
+		Body:      content.Body,
+	})
+
+	return &github.Issue{
+		Title: github.String(content.Title),
+		Body:  github.String(content.Body),
+	}, nil
+}
+
+// closeReport records one conditional operation with repositories to be
+// searched because the existing issue can not be found without API.
+func (x *dryRunPublisher) closeReport(ctx context.Context, report deepalert.Report, settings githubSettings) (*github.Issue, error) {
+	x.record(dryRunOperation{
+		Action: "find_and_close_issue",
+		Repos:  settings.candidateRepos(),
+		Labels: []string{safeLabel},
+		Body:   safeComment(report),
+	})
+
+	return nil, nil
+}
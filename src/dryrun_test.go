@@ -0,0 +1,121 @@
+package main_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/deepalert/deepalert"
+	"github.com/m-mizutani/golambda"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/deepalert/deepalert-github/src"
+)
+
+func TestDryRunPublish(t *testing.T) {
+	settings := main.GithubSettings{GithubRepo: "blue/orange"}
+
+	t.Run("new report writes only alert files", func(t *testing.T) {
+		report := newAlertReport(2)
+		issue, ops, err := main.DryRunPublish(report, settings)
+		require.NoError(t, err)
+		assert.Nil(t, issue)
+		require.Equal(t, 1, len(ops))
+		assert.Equal(t, "commit_files", ops[0].Action)
+		assert.Equal(t, "blue/orange", ops[0].Repo)
+		assert.Equal(t, "HEAD", ops[0].Branch)
+
+		alertPath, err := main.AlertToPath(report, report.Alerts[0])
+		require.NoError(t, err)
+		assert.Contains(t, ops[0].Paths, alertPath)
+		assert.Contains(t, ops[0].Paths, "2021/01/02/"+string(report.ID)+"/README.md")
+		assert.Contains(t, ops[0].Message, "2 alerts")
+	})
+
+	t.Run("published report writes alert files and issue", func(t *testing.T) {
+		report := newAlertReport(1)
+		report.Status = deepalert.StatusPublished
+		report.Result.Severity = deepalert.SevUrgent
+
+		s := settings
+		s.GithubBranch = "alerts"
+		issue, ops, err := main.DryRunPublish(report, s)
+		require.NoError(t, err)
+		require.NotNil(t, issue)
+		require.Equal(t, 2, len(ops))
+		assert.Equal(t, "publish_issue", ops[1].Action)
+		assert.Equal(t, "alerts", ops[1].Branch)
+		assert.Equal(t, "[blue] orange: alert 0", ops[1].Title)
+		assert.Contains(t, ops[1].Labels, "severity:urgent")
+		assert.Contains(t, ops[1].Body, "../tree/alerts/")
+		assert.Contains(t, ops[1].Body, main.ReportMarker(report.ID))
+		assert.Equal(t, ops[1].Body, issue.GetBody())
+	})
+
+	t.Run("commit message does not include alert description", func(t *testing.T) {
+		report := newAlertReport(1)
+		report.Alerts[0].Description = "fixes #12"
+		_, ops, err := main.DryRunPublish(report, settings)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(ops))
+		assert.Equal(t, "[Alert] report "+string(report.ID), ops[0].Message)
+	})
+
+	t.Run("safe report closes issue", func(t *testing.T) {
+		report := newAlertReport(1)
+		report.Status = deepalert.StatusPublished
+		report.Result = deepalert.ReportResult{Severity: deepalert.SevSafe, Reason: "known scanner"}
+
+		issue, ops, err := main.DryRunPublish(report, settings)
+		require.NoError(t, err)
+		assert.Nil(t, issue)
+		require.Equal(t, 2, len(ops))
+		assert.Equal(t, "find_and_close_issue", ops[0].Action)
+		assert.Equal(t, []string{"blue/orange"}, ops[0].Repos)
+		assert.Contains(t, ops[0].Body, "known scanner")
+		assert.Equal(t, "commit_files", ops[1].Action)
+	})
+
+	t.Run("safe report searches all routed repositories once", func(t *testing.T) {
+		report := newAlertReport(1)
+		report.Status = deepalert.StatusPublished
+		report.Result = deepalert.ReportResult{Severity: deepalert.SevSafe, Reason: "known scanner"}
+
+		s := settings
+		require.NoError(t, json.Unmarshal([]byte(`{"github_routes":[{"severity":"urgent","repo":"org/oncall"},{"repo":"org/triage"}]}`), &s))
+		_, ops, err := main.DryRunPublish(report, s)
+		require.NoError(t, err)
+		require.Equal(t, 2, len(ops))
+		assert.Equal(t, "find_and_close_issue", ops[0].Action)
+		assert.Equal(t, []string{"blue/orange", "org/oncall", "org/triage"}, ops[0].Repos)
+		assert.Equal(t, "org/triage", ops[1].Repo)
+	})
+}
+
+func TestHandlerDryRunWithoutCredentials(t *testing.T) {
+	const secretARN = "arn:aws:secretsmanager:us-east-1:111122223333:secret:dry-run"
+	mock, factory := golambda.NewSecretsManagerMock()
+	mock.Secrets[secretARN] = `{}`
+
+	args := main.Arguments{
+		SecretARN:  secretARN,
+		GitHubRepo: "blue/orange",
+		DryRun:     true,
+		NewSM:      factory,
+	}
+
+	report := newAlertReport(1)
+	report.Status = deepalert.StatusPublished
+	report.Result.Severity = deepalert.SevUrgent
+	raw, err := json.Marshal(report)
+	require.NoError(t, err)
+	body, err := json.Marshal(events.SNSEntity{Message: string(raw)})
+	require.NoError(t, err)
+
+	failures, err := main.Handler(args, golambda.Event{
+		Origin: events.SQSEvent{Records: []events.SQSMessage{{MessageId: "msg-1", Body: string(body)}}},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+}
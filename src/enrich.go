@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/deepalert/deepalert"
+	"github.com/deepalert/deepalert-github/src/md"
+	"github.com/m-mizutani/golambda"
+)
+
+// enrichLink is a quick-pivot link to external service of an attribute value.
+// URL is text/template, e.g.
+// https://www.virustotal.com/gui/ip-address/{{ .Value | pathEscape }}
+type enrichLink struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+
+	// tmpl is parsed URL when the link is loaded
+	tmpl *template.Template
+}
+
+// enrichLinkData is passed to URL template of enrichLink as "."
+type enrichLinkData struct {
+	Type  deepalert.AttrType
+	Key   string
+	Value string
+}
+
+var enrichLinkFuncs = template.FuncMap{
+	"pathEscape":  url.PathEscape,
+	"queryEscape": url.QueryEscape,
+	// base64url is used by VirusTotal to identify URL
+	"base64url": func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	},
+}
+
+// enrichLinks maps attribute type to links of the type
+type enrichLinks map[deepalert.AttrType][]enrichLink
+
+// UnmarshalJSON parses URL templates of links at loading settings, then an
+// invalid link is rejected before rendering any report.
+func (x *enrichLinks) UnmarshalJSON(data []byte) error {
+	var links map[deepalert.AttrType][]enrichLink
+	if err := unmarshalEmbeddedJSON(data, &links); err != nil {
+		return err
+	}
+
+	for attrType, typeLinks := range links {
+		for i := range typeLinks {
+			if err := typeLinks[i].parse(); err != nil {
+				return golambda.WrapError(err).With("type", attrType)
+			}
+		}
+	}
+
+	*x = links
+	return nil
+}
+
+func (x *enrichLink) parse() error {
+	if x.Name == "" {
+		return golambda.NewError("Enrich link requires name").With("link", x)
+	}
+
+	tmpl, err := template.New(x.Name).Funcs(enrichLinkFuncs).Option("missingkey=error").Parse(x.URL)
+	if err != nil {
+		return golambda.WrapError(err, "Failed to parse enrich link template").With("link", x)
+	}
+	// Unknown field such as {{ .Foo }} fails only at execution
+	if err := tmpl.Execute(ioutil.Discard, &enrichLinkData{}); err != nil {
+		return golambda.WrapError(err, "Failed to execute enrich link template").With("link", x)
+	}
+
+	x.tmpl = tmpl
+	return nil
+}
+
+// indicatorHost returns host name that the value points to
+func indicatorHost(attrType deepalert.AttrType, value string) string {
+	switch attrType {
+	case deepalert.TypeURL:
+		if u, err := url.Parse(value); err == nil {
+			return u.Hostname()
+		}
+	case deepalert.TypeIPAddr, deepalert.TypeDomainName:
+		return value
+	}
+	return ""
+}
+
+// buildEnrichLinks renders links of the value as " (VirusTotal, Shodan)".
+// In defang mode, a link to the indicator itself is not rendered.
+func buildEnrichLinks(attrType deepalert.AttrType, key, value string, opt bodyOptions) md.Contents {
+	links := opt.EnrichLinks[attrType]
+	if len(links) == 0 || value == "" {
+		return nil
+	}
+
+	host := indicatorHost(attrType, value)
+	var nodes md.Contents
+	for _, link := range links {
+		buf := new(bytes.Buffer)
+		if err := link.tmpl.Execute(buf, &enrichLinkData{Type: attrType, Key: key, Value: value}); err != nil {
+			logger.With("error", err).With("link", link).Error("Skip enrich link failed to execute")
+			continue
+		}
+
+		if opt.Defang && host != "" {
+			if u, err := url.Parse(buf.String()); err == nil && strings.EqualFold(u.Hostname(), host) {
+				continue
+			}
+		}
+
+		if len(nodes) > 0 {
+			nodes = append(nodes, md.ToLiteral(", "))
+		}
+		nodes = append(nodes, &md.Link{Content: md.ToLiteral(link.Name), URL: buf.String()})
+	}
+
+	if len(nodes) == 0 {
+		return nil
+	}
+	return append(append(md.Contents{md.ToLiteral(" (")}, nodes...), md.ToLiteral(")"))
+}
+
+// remoteAddrType guesses attribute type of remote address of activity that
+// may have port number
+func remoteAddrType(addr string) (deepalert.AttrType, string) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if net.ParseIP(host) != nil {
+		return deepalert.TypeIPAddr, host
+	}
+	return deepalert.TypeDomainName, host
+}
@@ -0,0 +1,73 @@
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/deepalert/deepalert-github/src"
+)
+
+func newEnrichOptions(t *testing.T, defang bool) main.BodyOptions {
+	var settings main.GithubSettings
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"github_defang": `+fmt.Sprint(defang)+`,
+		"github_enrich_links": {
+			"ipaddr": [
+				{"name": "VirusTotal", "url": "https://www.virustotal.com/gui/ip-address/{{ .Value | pathEscape }}"},
+				{"name": "Shodan", "url": "https://www.shodan.io/host/{{ .Value }}"}
+			],
+			"domain": [{"name": "VirusTotal", "url": "https://www.virustotal.com/gui/domain/{{ .Value }}"}],
+			"url": [
+				{"name": "VirusTotal", "url": "https://www.virustotal.com/gui/url/{{ .Value | base64url }}"},
+				{"name": "Open", "url": "{{ .Value }}"}
+			]
+		}
+	}`), &settings))
+	return settings.BodyOptions("main")
+}
+
+func TestBodyEnrichLinks(t *testing.T) {
+	report := newDefangReport()
+
+	buf, err := main.ReportToBody(report, newEnrichOptions(t, false))
+	require.NoError(t, err)
+	txt := buf.String()
+	if os.Getenv("VERBOSE") != "" {
+		fmt.Println(txt)
+	}
+
+	assert.Contains(t, txt, "- remote ( `ipaddr` ):  `198.51.100.1`  ([VirusTotal](https://www.virustotal.com/gui/ip-address/198.51.100.1), [Shodan](https://www.shodan.io/host/198.51.100.1))\n")
+	assert.Contains(t, txt, "[VirusTotal](https://www.virustotal.com/gui/url/aHR0cDovL2V2aWwuZXhhbXBsZS5jb20veA), [Open](http://evil.example.com/x))\n")
+	// Remote address without port and related domain in table cells
+	assert.Contains(t, txt, "|  `203.0.113.5:8080`  ([VirusTotal](https://www.virustotal.com/gui/ip-address/203.0.113.5), [Shodan](https://www.shodan.io/host/203.0.113.5)) |")
+	assert.Contains(t, txt, "|  `c2.example.net`  ([VirusTotal](https://www.virustotal.com/gui/domain/c2.example.net)) |")
+}
+
+func TestBodyEnrichLinksDefang(t *testing.T) {
+	report := newDefangReport()
+
+	buf, err := main.ReportToBody(report, newEnrichOptions(t, true))
+	require.NoError(t, err)
+	txt := buf.String()
+
+	// Link to the indicator itself is dropped in defang mode
+	assert.Contains(t, txt, "- url `hxxp://evil[.]example[.]com/x`  ([VirusTotal](https://www.virustotal.com/gui/url/aHR0cDovL2V2aWwuZXhhbXBsZS5jb20veA))\n")
+	assert.NotContains(t, txt, "[Open]")
+	assert.Contains(t, txt, "|  `c2[.]example[.]net`  ([VirusTotal](https://www.virustotal.com/gui/domain/c2.example.net)) |")
+}
+
+func TestEnrichLinksValidate(t *testing.T) {
+	for _, links := range []string{
+		`"{\"ipaddr\":[{\"name\":\"x\",\"url\":\"{{ .Value\"}]}"`,
+		`{"ipaddr":[{"name":"x","url":"https://example.com/{{ .Unknown }}"}]}`,
+		`{"ipaddr":[{"url":"https://example.com/{{ .Value }}"}]}`,
+	} {
+		var settings main.GithubSettings
+		assert.Error(t, json.Unmarshal([]byte(`{"github_enrich_links": `+links+`}`), &settings), links)
+	}
+}
@@ -1,6 +1,13 @@
 package main
 
 import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/deepalert/deepalert"
 	"github.com/google/go-github/v27/github"
 	"github.com/m-mizutani/golambda"
@@ -10,13 +17,181 @@ type GithubSettings githubSettings
 type Arguments arguments
 
 func Publish(report deepalert.Report, settings GithubSettings) (*github.Issue, error) {
-	return publishToGithub(report, githubSettings(settings))
+	client, err := githubSettings(settings).newClient()
+	if err != nil {
+		return nil, err
+	}
+	return publishToGithub(context.Background(), &githubPublisher{api: &githubClient{client: client}}, report, githubSettings(settings))
 }
 
+type BodyOptions = bodyOptions
+
 var (
 	ReportToBody = reportToBody
 )
 
-func Handler(args Arguments, event golambda.Event) error {
-	return handler(arguments(args), event)
+// Handler returns message IDs of failed records
+func Handler(args Arguments, event golambda.Event) ([]string, error) {
+	resp, err := handler(arguments(args), event)
+	if err != nil {
+		return nil, err
+	}
+
+	var failures []string
+	for _, f := range resp.BatchItemFailures {
+		failures = append(failures, f.ItemIdentifier)
+	}
+	return failures, nil
+}
+
+var (
+	ReportMarker = reportMarker
+)
+
+func PublishReport(client *github.Client, report deepalert.Report, settings GithubSettings) (*github.Issue, error) {
+	return publishReport(context.Background(), &githubClient{client: client}, report, githubSettings(settings))
+}
+
+func (x GithubSettings) NewClient() (*github.Client, error) {
+	return githubSettings(x).newClient()
+}
+
+func (x GithubSettings) ResolveRoute(report deepalert.Report) (repo string, drop bool, err error) {
+	route, err := githubSettings(x).resolveRoute(report)
+	if err != nil {
+		return "", false, err
+	}
+	return route.Repo, route.Action == routeDrop, nil
+}
+
+func CloseReport(client *github.Client, report deepalert.Report, settings GithubSettings) (*github.Issue, error) {
+	return closeReport(context.Background(), &githubClient{client: client}, report, githubSettings(settings))
+}
+
+type ClientCache struct {
+	cache *clientCache
+}
+
+func NewClientCache(now func() time.Time) *ClientCache {
+	cache := newClientCache()
+	cache.now = now
+	return &ClientCache{cache: cache}
+}
+
+func (x *ClientCache) GetSettings(secretARN string, factory golambda.SecretsManagerFactory) (GithubSettings, error) {
+	settings, err := x.cache.getSettings(secretARN, factory)
+	return GithubSettings(settings), err
+}
+
+func (x *ClientCache) GetClient(settings GithubSettings) (*github.Client, error) {
+	return x.cache.getClient(githubSettings(settings))
+}
+
+func (x *ClientCache) Invalidate() {
+	x.cache.invalidate()
+}
+
+func NewRetryTransport(tr http.RoundTripper, sleep func(ctx context.Context, d time.Duration) error) http.RoundTripper {
+	rt := newRetryTransport(tr)
+	rt.baseWait = time.Millisecond
+	rt.maxWait = 10 * time.Millisecond
+	rt.sleep = sleep
+	return rt
+}
+
+func ResolveBranch(client *github.Client, owner, repo, configured string) (string, error) {
+	return resolveBranch(context.Background(), client, owner, repo, configured)
+}
+
+var (
+	AlertToPath     = alertToPath
+	AlertToMarkdown = alertToMarkdown
+)
+
+func PublishAlert(client *github.Client, report deepalert.Report, settings GithubSettings) (string, error) {
+	return publishAlert(context.Background(), &githubClient{client: client}, report, githubSettings(settings))
+}
+
+func ToArchiveJSON(v interface{}, redactFields []string) ([]byte, error) {
+	return toArchiveJSON(v, redactFields)
+}
+
+func RenderCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	return renderCommand(args, stdin, stdout)
+}
+
+// DryRunPublish returns operations recorded by dry run publisher
+func DryRunPublish(report deepalert.Report, settings GithubSettings) (*github.Issue, []dryRunOperation, error) {
+	pub := &dryRunPublisher{}
+	issue, err := publishToGithub(context.Background(), pub, report, githubSettings(settings))
+	return issue, pub.operations, err
+}
+
+// FakeGithub is in-memory GitHub for tests of whole publishing flow
+type FakeGithub struct {
+	fake *fakeGithub
+}
+
+func NewFakeGithub() *FakeGithub {
+	return &FakeGithub{fake: newFakeGithub()}
+}
+
+func (x *FakeGithub) AddRepo(name, defaultBranch string, assignable ...string) {
+	x.fake.addRepo(name, defaultBranch, assignable...)
+}
+
+// SetBeforeUpdateRef sets hook called before a branch is updated by commit
+func (x *FakeGithub) SetBeforeUpdateRef(hook func(repo, branch string)) {
+	x.fake.beforeUpdateRef = hook
+}
+
+func (x *FakeGithub) PushFiles(repo, branch string, files map[string]string) {
+	x.fake.pushFiles(repo, branch, files)
+}
+
+func (x *FakeGithub) Files(repo, branch string) map[string]string {
+	return x.fake.files(repo, branch)
+}
+
+func (x *FakeGithub) CommitCount(repo, branch string) int {
+	return x.fake.commitCount(repo, branch)
+}
+
+func (x *FakeGithub) Issues(repo string) []*github.Issue {
+	return x.fake.issues(repo)
+}
+
+func (x *FakeGithub) Comments(repo string, number int) []string {
+	return x.fake.issueComments(repo, number)
+}
+
+func (x *FakeGithub) Cards(columnID int64) []int64 {
+	return x.fake.cards[columnID]
+}
+
+// NewServer starts fake GitHub API server backed by the same state
+func (x *FakeGithub) NewServer() *httptest.Server {
+	return newFakeGithubServer(x.fake)
+}
+
+// HandleRecords handles records with the fake as GitHub API and returns
+// message IDs of failed records
+func (x *FakeGithub) HandleRecords(settings GithubSettings, records []events.SQSMessage) []string {
+	pub := &githubPublisher{api: x.fake}
+	resp := handleRecords(context.Background(), pub, githubSettings(settings), records, newClientCache())
+
+	var failures []string
+	for _, f := range resp.BatchItemFailures {
+		failures = append(failures, f.ItemIdentifier)
+	}
+	return failures
+}
+
+var (
+	DefangText      = defangText
+	CloseOpenBlocks = closeOpenBlocks
+)
+
+func (x GithubSettings) BodyOptions(branch string) BodyOptions {
+	return githubSettings(x).bodyOptions(branch)
 }
@@ -0,0 +1,293 @@
+package main_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/deepalert/deepalert"
+	"github.com/google/go-github/v27/github"
+	"github.com/m-mizutani/golambda"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/deepalert/deepalert-github/src"
+)
+
+func toRecord(t *testing.T, messageID string, report deepalert.Report) events.SQSMessage {
+	raw, err := json.Marshal(report)
+	require.NoError(t, err)
+	body, err := json.Marshal(events.SNSEntity{Message: string(raw)})
+	require.NoError(t, err)
+	return events.SQSMessage{MessageId: messageID, Body: string(body)}
+}
+
+func labelNames(issue *github.Issue) []string {
+	var names []string
+	for _, label := range issue.Labels {
+		names = append(names, label.GetName())
+	}
+	return names
+}
+
+// testStatusTransition publishes a report from new to safe via handle and
+// checks state of the fake GitHub
+func testStatusTransition(t *testing.T, fake *main.FakeGithub, handle func(records ...events.SQSMessage) []string) {
+	const repo = "blue/orange"
+	report := newAlertReport(2)
+	dir := "2021/01/02/" + string(report.ID) + "/"
+
+	// New: only alert files in one commit
+	require.Empty(t, handle(toRecord(t, "new", report)))
+	files := fake.Files(repo, "main")
+	assert.Contains(t, files, dir+"README.md")
+	assert.Contains(t, files, dir+"report.json")
+	assert.Contains(t, files, "2021/01/02/README.md")
+	assert.Equal(t, 1, fake.CommitCount(repo, "main"))
+	assert.Empty(t, fake.Issues(repo))
+
+	// Published: issue is created
+	report.Status = deepalert.StatusPublished
+	report.Result = deepalert.ReportResult{Severity: deepalert.SevUrgent, Reason: "bad"}
+	require.Empty(t, handle(toRecord(t, "published", report)))
+	issues := fake.Issues(repo)
+	require.Equal(t, 1, len(issues))
+	assert.Equal(t, "[blue] orange: alert 0", issues[0].GetTitle())
+	assert.Contains(t, issues[0].GetBody(), main.ReportMarker(report.ID))
+	assert.Contains(t, issues[0].GetBody(), "../tree/main/"+dir)
+	assert.Contains(t, labelNames(issues[0]), "severity:urgent")
+	assert.Equal(t, []string{"oncall"}, func() []string {
+		var users []string
+		for _, u := range issues[0].Assignees {
+			users = append(users, u.GetLogin())
+		}
+		return users
+	}())
+	assert.Equal(t, []int64{issues[0].GetID()}, fake.Cards(42))
+	assert.Contains(t, fake.Files(repo, "main")[dir+"README.md"], "| published | urgent |")
+
+	// Published again: the same issue is kept
+	require.Empty(t, handle(toRecord(t, "again", report)))
+	require.Equal(t, 1, len(fake.Issues(repo)))
+
+	// Safe: the issue is closed with comment
+	report.Result = deepalert.ReportResult{Severity: deepalert.SevSafe, Reason: "known scanner"}
+	require.Empty(t, handle(toRecord(t, "safe", report)))
+	issues = fake.Issues(repo)
+	require.Equal(t, 1, len(issues))
+	assert.Equal(t, "closed", issues[0].GetState())
+	assert.Contains(t, labelNames(issues[0]), "resolved:safe")
+	comments := fake.Comments(repo, issues[0].GetNumber())
+	require.Equal(t, 1, len(comments))
+	assert.Contains(t, comments[0], "known scanner")
+
+	// Urgent again: the closed issue is reopened even if body is not changed
+	report.Result = deepalert.ReportResult{Severity: deepalert.SevUrgent, Reason: "bad"}
+	require.Empty(t, handle(toRecord(t, "reopen", report)))
+	issues = fake.Issues(repo)
+	require.Equal(t, 1, len(issues))
+	assert.Equal(t, "open", issues[0].GetState())
+	assert.NotContains(t, labelNames(issues[0]), "resolved:safe")
+	assert.Contains(t, labelNames(issues[0]), "severity:urgent")
+
+	// Unclassified: the old severity label is replaced and a label attached
+	// by analysts is kept
+	issues[0].Labels = append(issues[0].Labels, github.Label{Name: github.String("triaged")})
+	report.Result = deepalert.ReportResult{Severity: deepalert.SevUnclassified}
+	require.Empty(t, handle(toRecord(t, "unclassified", report)))
+	issues = fake.Issues(repo)
+	require.Equal(t, 1, len(issues))
+	assert.NotContains(t, labelNames(issues[0]), "severity:urgent")
+	assert.Contains(t, labelNames(issues[0]), "severity:unclassified")
+	assert.Contains(t, labelNames(issues[0]), "triaged")
+}
+
+// testCommitConflict moves the branch once before updating ref
+func testCommitConflict(t *testing.T, fake *main.FakeGithub, handle func(records ...events.SQSMessage) []string) {
+	const repo = "blue/orange"
+	moved := false
+	fake.SetBeforeUpdateRef(func(repoName, branch string) {
+		if !moved {
+			moved = true
+			fake.PushFiles(repoName, branch, map[string]string{"other.md": "pushed"})
+		}
+	})
+	defer fake.SetBeforeUpdateRef(nil)
+
+	report := newAlertReport(1)
+	bad := toRecord(t, "bad", report)
+	bad.Body = "broken"
+	assert.Equal(t, []string{"bad"}, handle(toRecord(t, "good", report), bad))
+
+	assert.True(t, moved)
+	files := fake.Files(repo, "main")
+	assert.Equal(t, "pushed", files["other.md"])
+	alertPath, err := main.AlertToPath(report, report.Alerts[0])
+	require.NoError(t, err)
+	assert.Contains(t, files, alertPath)
+	assert.Equal(t, 2, fake.CommitCount(repo, "main"))
+}
+
+func newFakeSettings() main.GithubSettings {
+	var settings main.GithubSettings
+	if err := json.Unmarshal([]byte(`{
+		"github_assign_rules": [{"severity":"urgent","assignees":["oncall","nobody"],"project_column_id":42}]
+	}`), &settings); err != nil {
+		panic(err)
+	}
+	settings.GithubRepo = "blue/orange"
+	return settings
+}
+
+func TestFakeGithubInMemory(t *testing.T) {
+	newFake := func() (*main.FakeGithub, func(records ...events.SQSMessage) []string) {
+		fake := main.NewFakeGithub()
+		fake.AddRepo("blue/orange", "main", "oncall")
+		return fake, func(records ...events.SQSMessage) []string {
+			return fake.HandleRecords(newFakeSettings(), records)
+		}
+	}
+
+	t.Run("status transition", func(t *testing.T) {
+		fake, handle := newFake()
+		testStatusTransition(t, fake, handle)
+	})
+	t.Run("commit conflict", func(t *testing.T) {
+		fake, handle := newFake()
+		testCommitConflict(t, fake, handle)
+	})
+}
+
+func TestFakeGithubServer(t *testing.T) {
+	newFake := func(t *testing.T) (*main.FakeGithub, func(records ...events.SQSMessage) []string) {
+		fake := main.NewFakeGithub()
+		fake.AddRepo("blue/orange", "main", "oncall")
+		srv := fake.NewServer()
+		t.Cleanup(srv.Close)
+
+		secretARN := "arn:aws:secretsmanager:us-east-1:111122223333:secret:" + t.Name()
+		mock, factory := golambda.NewSecretsManagerMock()
+		mock.Secrets[secretARN] = `{"github_token":"xxx","github_assign_rules":[{"severity":"urgent","assignees":["oncall","nobody"],"project_column_id":42}]}`
+		args := main.Arguments{
+			SecretARN:      secretARN,
+			GitHubEndpoint: srv.URL + "/",
+			GitHubRepo:     "blue/orange",
+			NewSM:          factory,
+		}
+
+		return fake, func(records ...events.SQSMessage) []string {
+			failures, err := main.Handler(args, golambda.Event{Origin: events.SQSEvent{Records: records}})
+			require.NoError(t, err)
+			return failures
+		}
+	}
+
+	t.Run("status transition", func(t *testing.T) {
+		fake, handle := newFake(t)
+		testStatusTransition(t, fake, handle)
+	})
+	t.Run("commit conflict", func(t *testing.T) {
+		fake, handle := newFake(t)
+		testCommitConflict(t, fake, handle)
+	})
+}
+
+func TestFakeGithubDefuseReferences(t *testing.T) {
+	const repo = "blue/orange"
+	fake := main.NewFakeGithub()
+	fake.AddRepo(repo, "main", "oncall")
+
+	settings := newFakeSettings()
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"github_assign_rules": [{"severity":"urgent","mentions":["my-org/sec-team"]}]
+	}`), &settings))
+
+	report := newAlertReport(1)
+	report.Status = deepalert.StatusPublished
+	report.Result = deepalert.ReportResult{Severity: deepalert.SevUrgent, Reason: "ask @org/security-team"}
+	report.Alerts[0].Description = "see #1"
+	require.Empty(t, fake.HandleRecords(settings, []events.SQSMessage{toRecord(t, "published", report)}))
+
+	issues := fake.Issues(repo)
+	require.Equal(t, 1, len(issues))
+	body := issues[0].GetBody()
+	assert.Contains(t, body, "cc: @my-org/sec-team\n")
+	assert.NotContains(t, body, "@org/security-team")
+	assert.Contains(t, body, "@\u200borg/security-team")
+	assert.NotContains(t, body, "see #1")
+}
+
+// testRouteChange publishes a report to triage and then to oncall by change
+// of severity
+func testRouteChange(t *testing.T, fake *main.FakeGithub, handle func(records ...events.SQSMessage) []string) {
+	report := newAlertReport(1)
+	report.Status = deepalert.StatusPublished
+	report.Result = deepalert.ReportResult{Severity: deepalert.SevUnclassified}
+	require.Empty(t, handle(toRecord(t, "unclassified", report)))
+	require.Equal(t, 1, len(fake.Issues("org/triage")))
+	assert.Empty(t, fake.Issues("org/oncall"))
+
+	report.Result = deepalert.ReportResult{Severity: deepalert.SevUrgent, Reason: "bad"}
+	require.Empty(t, handle(toRecord(t, "urgent", report)))
+	oncall := fake.Issues("org/oncall")
+	require.Equal(t, 1, len(oncall))
+	assert.Equal(t, "open", oncall[0].GetState())
+	assert.Contains(t, oncall[0].GetBody(), main.ReportMarker(report.ID))
+	assert.Contains(t, labelNames(oncall[0]), "severity:urgent")
+
+	triage := fake.Issues("org/triage")
+	require.Equal(t, 1, len(triage))
+	assert.Equal(t, "closed", triage[0].GetState())
+	assert.NotContains(t, labelNames(triage[0]), "report:"+string(report.ID))
+	comments := fake.Comments("org/triage", triage[0].GetNumber())
+	require.Equal(t, 1, len(comments))
+	assert.Contains(t, comments[0], "org/oncall#1")
+
+	// Published again: the moved issue is updated
+	require.Empty(t, handle(toRecord(t, "again", report)))
+	assert.Equal(t, 1, len(fake.Issues("org/oncall")))
+	assert.Equal(t, 1, len(fake.Issues("org/triage")))
+}
+
+const fakeRoutes = `[{"severity":"urgent","repo":"org/oncall"},{"severity":"unclassified","repo":"org/triage"}]`
+
+func TestFakeGithubRouteChange(t *testing.T) {
+	newFake := func() *main.FakeGithub {
+		fake := main.NewFakeGithub()
+		fake.AddRepo("blue/orange", "main")
+		fake.AddRepo("org/triage", "main")
+		fake.AddRepo("org/oncall", "main")
+		return fake
+	}
+
+	t.Run("in memory", func(t *testing.T) {
+		fake := newFake()
+		settings := newFakeSettings()
+		require.NoError(t, json.Unmarshal([]byte(`{"github_routes":`+fakeRoutes+`}`), &settings))
+		testRouteChange(t, fake, func(records ...events.SQSMessage) []string {
+			return fake.HandleRecords(settings, records)
+		})
+	})
+
+	t.Run("server", func(t *testing.T) {
+		fake := newFake()
+		srv := fake.NewServer()
+		defer srv.Close()
+
+		secretARN := "arn:aws:secretsmanager:us-east-1:111122223333:secret:" + t.Name()
+		mock, factory := golambda.NewSecretsManagerMock()
+		mock.Secrets[secretARN] = `{"github_token":"xxx"}`
+		args := main.Arguments{
+			SecretARN:      secretARN,
+			GitHubEndpoint: srv.URL + "/",
+			GitHubRepo:     "blue/orange",
+			GitHubRoutes:   fakeRoutes,
+			NewSM:          factory,
+		}
+		testRouteChange(t, fake, func(records ...events.SQSMessage) []string {
+			failures, err := main.Handler(args, golambda.Event{Origin: events.SQSEvent{Records: records}})
+			require.NoError(t, err)
+			return failures
+		})
+	})
+}
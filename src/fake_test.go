@@ -0,0 +1,520 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/deepalert/deepalert"
+	"github.com/google/go-github/v27/github"
+	"github.com/m-mizutani/golambda"
+)
+
+// fakeGithub keeps repositories, git objects and issues in memory. It works
+// as githubAPI directly and as backend of fake GitHub API server.
+type fakeGithub struct {
+	mutex   sync.Mutex
+	repos   map[string]*fakeRepo
+	cards   map[int64][]int64
+	issueID int64
+
+	// beforeUpdateRef is called before a branch is updated by commit. Test can
+	// move the branch by pushFiles in it to make conflict.
+	beforeUpdateRef func(repo, branch string)
+}
+
+type fakeRepo struct {
+	name          string
+	defaultBranch string
+	branches      map[string]string // branch name -> commit SHA
+	commits       map[string]fakeCommit
+	trees         map[string]map[string]string // tree SHA -> path -> content
+	issues        []*github.Issue
+	comments      map[int][]string
+	labels        map[string]string // lower case name -> name
+	assignable    map[string]bool
+}
+
+type fakeCommit struct {
+	tree    string
+	parents []string
+	message string
+}
+
+func newFakeGithub() *fakeGithub {
+	return &fakeGithub{
+		repos: map[string]*fakeRepo{},
+		cards: map[int64][]int64{},
+	}
+}
+
+// addRepo creates a repository with an initial empty commit on default branch
+func (x *fakeGithub) addRepo(name, defaultBranch string, assignable ...string) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	repo := &fakeRepo{
+		name:          name,
+		defaultBranch: defaultBranch,
+		branches:      map[string]string{},
+		commits:       map[string]fakeCommit{},
+		trees:         map[string]map[string]string{},
+		comments:      map[int][]string{},
+		labels:        map[string]string{},
+		assignable:    map[string]bool{},
+	}
+	for _, user := range assignable {
+		repo.assignable[user] = true
+	}
+	tree := repo.putTree(map[string]string{})
+	repo.branches[defaultBranch] = repo.putCommit(tree, nil, "initial commit")
+	x.repos[name] = repo
+}
+
+func (x *fakeGithub) lookupRepo(owner, repo string) (*fakeRepo, error) {
+	r, ok := x.repos[owner+"/"+repo]
+	if !ok {
+		return nil, golambda.NewError("Repository not found").With("owner", owner).With("repo", repo)
+	}
+	return r, nil
+}
+
+func (x *fakeRepo) putTree(files map[string]string) string {
+	var paths []string
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	h := sha1.New()
+	for _, p := range paths {
+		fmt.Fprintf(h, "%s\x00%s\x00", p, files[p])
+	}
+	sha := fmt.Sprintf("%x", h.Sum(nil))
+	x.trees[sha] = files
+	return sha
+}
+
+func (x *fakeRepo) putCommit(tree string, parents []string, message string) string {
+	sha := fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("%s %v %s %d", tree, parents, message, len(x.commits)))))
+	x.commits[sha] = fakeCommit{tree: tree, parents: parents, message: message}
+	return sha
+}
+
+// mergeTree returns a new tree SHA that has files of the base tree and new files
+func (x *fakeRepo) mergeTree(baseTree string, files map[string]string) (string, error) {
+	base, ok := x.trees[baseTree]
+	if !ok {
+		return "", golambda.NewError("Tree not found").With("tree", baseTree)
+	}
+
+	merged := map[string]string{}
+	for p, c := range base {
+		merged[p] = c
+	}
+	for p, c := range files {
+		merged[p] = c
+	}
+	return x.putTree(merged), nil
+}
+
+// resolveRef returns commit SHA of a branch name or commit SHA
+func (x *fakeRepo) resolveRef(ref string) (string, bool) {
+	if sha, ok := x.branches[ref]; ok {
+		return sha, true
+	}
+	if _, ok := x.commits[ref]; ok {
+		return ref, true
+	}
+	return "", false
+}
+
+func (x *fakeRepo) readFile(ref, filePath string) (string, bool) {
+	sha, ok := x.resolveRef(ref)
+	if !ok {
+		return "", false
+	}
+	content, ok := x.trees[x.commits[sha].tree][filePath]
+	return content, ok
+}
+
+// updateBranch moves the branch only if it is fast-forward
+func (x *fakeRepo) updateBranch(branch, commitSHA string) bool {
+	head := x.branches[branch]
+	for _, parent := range x.commits[commitSHA].parents {
+		if parent == head {
+			x.branches[branch] = commitSHA
+			return true
+		}
+	}
+	return false
+}
+
+func (x *fakeRepo) createBranch(branch, commitSHA string) bool {
+	if _, ok := x.branches[branch]; ok {
+		return false
+	}
+	x.branches[branch] = commitSHA
+	return true
+}
+
+// pushFiles commits files on the branch as other process does
+func (x *fakeGithub) pushFiles(repoName, branch string, files map[string]string) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	repo := x.repos[repoName]
+	head := repo.branches[branch]
+	tree, _ := repo.mergeTree(repo.commits[head].tree, files)
+	repo.branches[branch] = repo.putCommit(tree, []string{head}, "pushed by other")
+}
+
+// files returns all files on the branch
+func (x *fakeGithub) files(repoName, branch string) map[string]string {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	repo := x.repos[repoName]
+	return repo.trees[repo.commits[repo.branches[branch]].tree]
+}
+
+func (x *fakeGithub) commitCount(repoName, branch string) int {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	repo := x.repos[repoName]
+	n := 0
+	for sha := repo.branches[branch]; sha != ""; n++ {
+		parents := repo.commits[sha].parents
+		if len(parents) == 0 {
+			break
+		}
+		sha = parents[0]
+	}
+	return n
+}
+
+func (x *fakeGithub) issues(repoName string) []*github.Issue {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.repos[repoName].issues
+}
+
+func (x *fakeGithub) issueComments(repoName string, number int) []string {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.repos[repoName].comments[number]
+}
+
+func (x *fakeRepo) lookupIssue(number int) (*github.Issue, error) {
+	if number < 1 || len(x.issues) < number {
+		return nil, golambda.NewError("Issue not found").With("repo", x.name).With("number", number)
+	}
+	return x.issues[number-1], nil
+}
+
+func (x *fakeRepo) addLabels(issue *github.Issue, labels []string) {
+	for _, name := range labels {
+		exists := false
+		for _, label := range issue.Labels {
+			if strings.EqualFold(label.GetName(), name) {
+				exists = true
+			}
+		}
+		if !exists {
+			issue.Labels = append(issue.Labels, github.Label{Name: github.String(name)})
+		}
+		if _, ok := x.labels[strings.ToLower(name)]; !ok {
+			x.labels[strings.ToLower(name)] = name
+		}
+	}
+}
+
+func (x *fakeRepo) removeLabel(issue *github.Issue, name string) {
+	labels := issue.Labels[:0]
+	for _, label := range issue.Labels {
+		if !strings.EqualFold(label.GetName(), name) {
+			labels = append(labels, label)
+		}
+	}
+	issue.Labels = labels
+}
+
+func (x *fakeGithub) newIssue(repo *fakeRepo, req *github.IssueRequest) *github.Issue {
+	x.issueID++
+	issue := &github.Issue{
+		ID:            github.Int64(x.issueID),
+		Number:        github.Int(len(repo.issues) + 1),
+		Title:         req.Title,
+		Body:          req.Body,
+		State:         github.String("open"),
+		RepositoryURL: github.String("https://api.github.com/repos/" + repo.name),
+	}
+	if req.Labels != nil {
+		repo.addLabels(issue, *req.Labels)
+	}
+	if req.Assignees != nil {
+		for _, user := range *req.Assignees {
+			issue.Assignees = append(issue.Assignees, &github.User{Login: github.String(user)})
+		}
+	}
+	if req.Milestone != nil {
+		issue.Milestone = &github.Milestone{Number: req.Milestone}
+	}
+
+	repo.issues = append(repo.issues, issue)
+	return issue
+}
+
+func applyIssueRequest(issue *github.Issue, req *github.IssueRequest) {
+	if req.Title != nil {
+		issue.Title = req.Title
+	}
+	if req.Body != nil {
+		issue.Body = req.Body
+	}
+	if req.State != nil {
+		issue.State = req.State
+	}
+}
+
+// listIssues returns issues that have all labels in state ("open", "closed"
+// or "all")
+func (x *fakeRepo) listIssues(labels []string, state string) []*github.Issue {
+	var issues []*github.Issue
+	for _, issue := range x.issues {
+		if state != "all" && issue.GetState() != state {
+			continue
+		}
+		matched := true
+		for _, name := range labels {
+			found := false
+			for _, label := range issue.Labels {
+				found = found || strings.EqualFold(label.GetName(), name)
+			}
+			matched = matched && found
+		}
+		if matched {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// githubAPI implementation
+
+func (x *fakeGithub) resolveBranch(ctx context.Context, owner, repo, configured string) (string, error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	r, err := x.lookupRepo(owner, repo)
+	if err != nil {
+		return "", err
+	}
+	if configured == "" {
+		return r.defaultBranch, nil
+	}
+	r.createBranch(configured, r.branches[r.defaultBranch])
+	return configured, nil
+}
+
+func (x *fakeGithub) readFile(ctx context.Context, owner, repo, ref, filePath string) ([]byte, error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	r, err := x.lookupRepo(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	content, ok := r.readFile(ref, filePath)
+	if !ok {
+		return nil, nil
+	}
+	return []byte(content), nil
+}
+
+func (x *fakeGithub) commitFiles(ctx context.Context, owner, repo, branch, message string, build archiveBuilder) (string, error) {
+	for attempt := 1; ; attempt++ {
+		x.mutex.Lock()
+		r, err := x.lookupRepo(owner, repo)
+		if err != nil {
+			x.mutex.Unlock()
+			return "", err
+		}
+		head, ok := r.branches[branch]
+		x.mutex.Unlock()
+		if !ok {
+			return "", golambda.NewError("Branch not found").With("branch", branch)
+		}
+
+		// build reads files via readFile, then lock must be released
+		files, err := build(head)
+		if err != nil {
+			return "", err
+		}
+
+		if x.beforeUpdateRef != nil {
+			x.beforeUpdateRef(r.name, branch)
+		}
+
+		x.mutex.Lock()
+		newFiles := map[string]string{}
+		for _, file := range files {
+			newFiles[file.Path] = string(file.Data)
+		}
+		baseTree := r.commits[head].tree
+		tree, err := r.mergeTree(baseTree, newFiles)
+		if err != nil {
+			x.mutex.Unlock()
+			return "", err
+		}
+		if tree == baseTree {
+			x.mutex.Unlock()
+			return head, nil
+		}
+
+		commit := r.putCommit(tree, []string{head}, message)
+		updated := r.updateBranch(branch, commit)
+		x.mutex.Unlock()
+
+		if updated {
+			return commit, nil
+		}
+		if attempt >= maxCommitAttempts {
+			return "", golambda.NewError("Failed to update ref").With("branch", branch)
+		}
+	}
+}
+
+func (x *fakeGithub) findIssue(ctx context.Context, repos []string, reportID deepalert.ReportID) (*github.Issue, error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	for _, name := range repos {
+		repo, ok := x.repos[name]
+		if !ok {
+			continue
+		}
+		for _, issue := range repo.listIssues([]string{reportLabel(reportID)}, "all") {
+			if strings.Contains(issue.GetBody(), reportMarker(reportID)) {
+				return issue, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (x *fakeGithub) createIssue(ctx context.Context, owner, repo string, req *github.IssueRequest) (*github.Issue, error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	r, err := x.lookupRepo(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	return x.newIssue(r, req), nil
+}
+
+func (x *fakeGithub) editIssue(ctx context.Context, owner, repo string, number int, req *github.IssueRequest) (*github.Issue, error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	r, err := x.lookupRepo(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	issue, err := r.lookupIssue(number)
+	if err != nil {
+		return nil, err
+	}
+	applyIssueRequest(issue, req)
+	return issue, nil
+}
+
+func (x *fakeGithub) createComment(ctx context.Context, owner, repo string, number int, body string) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	r, err := x.lookupRepo(owner, repo)
+	if err != nil {
+		return err
+	}
+	if _, err := r.lookupIssue(number); err != nil {
+		return err
+	}
+	r.comments[number] = append(r.comments[number], body)
+	return nil
+}
+
+func (x *fakeGithub) ensureLabels(ctx context.Context, owner, repo string, labels []string) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	r, err := x.lookupRepo(owner, repo)
+	if err != nil {
+		return err
+	}
+	for _, name := range labels {
+		if _, ok := r.labels[strings.ToLower(name)]; !ok {
+			r.labels[strings.ToLower(name)] = name
+		}
+	}
+	return nil
+}
+
+func (x *fakeGithub) addLabels(ctx context.Context, owner, repo string, number int, labels []string) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	r, err := x.lookupRepo(owner, repo)
+	if err != nil {
+		return err
+	}
+	issue, err := r.lookupIssue(number)
+	if err != nil {
+		return err
+	}
+	r.addLabels(issue, labels)
+	return nil
+}
+
+func (x *fakeGithub) removeLabel(ctx context.Context, owner, repo string, number int, label string) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	r, err := x.lookupRepo(owner, repo)
+	if err != nil {
+		return err
+	}
+	issue, err := r.lookupIssue(number)
+	if err != nil {
+		return err
+	}
+	r.removeLabel(issue, label)
+	return nil
+}
+
+func (x *fakeGithub) validAssignees(ctx context.Context, owner, repo string, assignees []string) []string {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	r, err := x.lookupRepo(owner, repo)
+	if err != nil {
+		return nil
+	}
+	var valid []string
+	for _, user := range assignees {
+		if r.assignable[user] {
+			valid = append(valid, user)
+		}
+	}
+	return valid
+}
+
+func (x *fakeGithub) addProjectCard(ctx context.Context, columnID int64, issue *github.Issue) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	x.cards[columnID] = append(x.cards[columnID], issue.GetID())
+}
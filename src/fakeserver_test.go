@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v27/github"
+)
+
+// newFakeGithubServer serves GitHub REST API used by githubClient with state
+// of fakeGithub. Endpoint of the server is set as GithubEndpoint.
+func newFakeGithubServer(fake *fakeGithub) *httptest.Server {
+	srv := &fakeGithubServer{fake: fake}
+	return httptest.NewServer(srv)
+}
+
+type fakeGithubServer struct {
+	fake *fakeGithub
+}
+
+type fakeRoute struct {
+	method  string
+	pattern *regexp.Regexp
+	handle  func(s *fakeGithubServer, w http.ResponseWriter, r *http.Request, repo *fakeRepo, args []string)
+}
+
+const fakeRepoPath = `^/repos/([^/]+/[^/]+)`
+
+var fakeUpdateRefPath = regexp.MustCompile(fakeRepoPath + `/git/refs/heads/(.+)$`)
+
+var fakeRoutes = []fakeRoute{
+	{"GET", regexp.MustCompile(fakeRepoPath + `$`), (*fakeGithubServer).getRepository},
+	{"GET", regexp.MustCompile(fakeRepoPath + `/branches/(.+)$`), (*fakeGithubServer).getBranch},
+	{"POST", regexp.MustCompile(fakeRepoPath + `/git/refs$`), (*fakeGithubServer).createRef},
+	{"PATCH", fakeUpdateRefPath, (*fakeGithubServer).updateRef},
+	{"POST", regexp.MustCompile(fakeRepoPath + `/git/trees$`), (*fakeGithubServer).createTree},
+	{"POST", regexp.MustCompile(fakeRepoPath + `/git/commits$`), (*fakeGithubServer).createCommit},
+	{"GET", regexp.MustCompile(fakeRepoPath + `/contents/(.+)$`), (*fakeGithubServer).getContents},
+	{"POST", regexp.MustCompile(fakeRepoPath + `/labels$`), (*fakeGithubServer).createLabel},
+	{"GET", regexp.MustCompile(fakeRepoPath + `/assignees/(.+)$`), (*fakeGithubServer).checkAssignee},
+	{"GET", regexp.MustCompile(fakeRepoPath + `/issues$`), (*fakeGithubServer).listIssues},
+	{"POST", regexp.MustCompile(fakeRepoPath + `/issues$`), (*fakeGithubServer).createIssue},
+	{"PATCH", regexp.MustCompile(fakeRepoPath + `/issues/(\d+)$`), (*fakeGithubServer).editIssue},
+	{"POST", regexp.MustCompile(fakeRepoPath + `/issues/(\d+)/labels$`), (*fakeGithubServer).addLabels},
+	{"DELETE", regexp.MustCompile(fakeRepoPath + `/issues/(\d+)/labels/(.+)$`), (*fakeGithubServer).removeLabel},
+	{"POST", regexp.MustCompile(fakeRepoPath + `/issues/(\d+)/comments$`), (*fakeGithubServer).createComment},
+}
+
+var fakeCardPath = regexp.MustCompile(`^/projects/columns/(\d+)/cards$`)
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"message": msg})
+}
+
+func (x *fakeGithubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// updateRef calls beforeUpdateRef hook without lock
+	if m := fakeUpdateRefPath.FindStringSubmatch(r.URL.Path); m != nil && r.Method == "PATCH" {
+		if x.fake.beforeUpdateRef != nil {
+			x.fake.beforeUpdateRef(m[1], m[2])
+		}
+	}
+
+	x.fake.mutex.Lock()
+	defer x.fake.mutex.Unlock()
+
+	if m := fakeCardPath.FindStringSubmatch(r.URL.Path); m != nil && r.Method == "POST" {
+		x.createProjectCard(w, r, m[1])
+		return
+	}
+
+	for _, route := range fakeRoutes {
+		m := route.pattern.FindStringSubmatch(r.URL.Path)
+		if m == nil || route.method != r.Method {
+			continue
+		}
+
+		repo, ok := x.fake.repos[m[1]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		route.handle(x, w, r, repo, m[2:])
+		return
+	}
+
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (x *fakeGithubServer) getRepository(w http.ResponseWriter, r *http.Request, repo *fakeRepo, args []string) {
+	writeJSON(w, http.StatusOK, &github.Repository{
+		FullName:      github.String(repo.name),
+		DefaultBranch: github.String(repo.defaultBranch),
+	})
+}
+
+func (x *fakeGithubServer) getBranch(w http.ResponseWriter, r *http.Request, repo *fakeRepo, args []string) {
+	sha, ok := repo.branches[args[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Branch not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &github.Branch{
+		Name: github.String(args[0]),
+		Commit: &github.RepositoryCommit{
+			SHA: github.String(sha),
+			Commit: &github.Commit{
+				Tree: &github.Tree{SHA: github.String(repo.commits[sha].tree)},
+			},
+		},
+	})
+}
+
+func (x *fakeGithubServer) createRef(w http.ResponseWriter, r *http.Request, repo *fakeRepo, args []string) {
+	var req struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, ok := repo.commits[req.SHA]; !ok {
+		writeError(w, http.StatusUnprocessableEntity, "Object does not exist")
+		return
+	}
+	if !repo.createBranch(strings.TrimPrefix(req.Ref, "refs/heads/"), req.SHA) {
+		writeError(w, http.StatusUnprocessableEntity, "Reference already exists")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, &github.Reference{
+		Ref:    github.String(req.Ref),
+		Object: &github.GitObject{SHA: github.String(req.SHA)},
+	})
+}
+
+func (x *fakeGithubServer) updateRef(w http.ResponseWriter, r *http.Request, repo *fakeRepo, args []string) {
+	var req struct {
+		SHA   string `json:"sha"`
+		Force bool   `json:"force"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, ok := repo.branches[args[0]]; !ok {
+		writeError(w, http.StatusUnprocessableEntity, "Reference does not exist")
+		return
+	}
+	if !repo.updateBranch(args[0], req.SHA) {
+		writeError(w, http.StatusUnprocessableEntity, "Update is not a fast forward")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &github.Reference{
+		Ref:    github.String("refs/heads/" + args[0]),
+		Object: &github.GitObject{SHA: github.String(req.SHA)},
+	})
+}
+
+func (x *fakeGithubServer) createTree(w http.ResponseWriter, r *http.Request, repo *fakeRepo, args []string) {
+	var req struct {
+		BaseTree string `json:"base_tree"`
+		Tree     []struct {
+			Path    string `json:"path"`
+			Content string `json:"content"`
+		} `json:"tree"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	files := map[string]string{}
+	for _, entry := range req.Tree {
+		files[entry.Path] = entry.Content
+	}
+	sha, err := repo.mergeTree(req.BaseTree, files)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, &github.Tree{SHA: github.String(sha)})
+}
+
+func (x *fakeGithubServer) createCommit(w http.ResponseWriter, r *http.Request, repo *fakeRepo, args []string) {
+	var req struct {
+		Message string   `json:"message"`
+		Tree    string   `json:"tree"`
+		Parents []string `json:"parents"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, ok := repo.trees[req.Tree]; !ok {
+		writeError(w, http.StatusUnprocessableEntity, "Tree does not exist")
+		return
+	}
+
+	sha := repo.putCommit(req.Tree, req.Parents, req.Message)
+	writeJSON(w, http.StatusCreated, &github.Commit{SHA: github.String(sha)})
+}
+
+func (x *fakeGithubServer) getContents(w http.ResponseWriter, r *http.Request, repo *fakeRepo, args []string) {
+	ref := r.URL.Query().Get("ref")
+	if ref == "" {
+		ref = repo.defaultBranch
+	}
+	content, ok := repo.readFile(ref, args[0])
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &github.RepositoryContent{
+		Type:     github.String("file"),
+		Path:     github.String(args[0]),
+		Encoding: github.String("base64"),
+		Content:  github.String(base64.StdEncoding.EncodeToString([]byte(content))),
+	})
+}
+
+func (x *fakeGithubServer) createLabel(w http.ResponseWriter, r *http.Request, repo *fakeRepo, args []string) {
+	var label github.Label
+	if err := json.NewDecoder(r.Body).Decode(&label); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, ok := repo.labels[strings.ToLower(label.GetName())]; ok {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+		return
+	}
+
+	repo.labels[strings.ToLower(label.GetName())] = label.GetName()
+	writeJSON(w, http.StatusCreated, &label)
+}
+
+func (x *fakeGithubServer) checkAssignee(w http.ResponseWriter, r *http.Request, repo *fakeRepo, args []string) {
+	if repo.assignable[args[0]] {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (x *fakeGithubServer) createIssue(w http.ResponseWriter, r *http.Request, repo *fakeRepo, args []string) {
+	var req github.IssueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Assignees != nil {
+		for _, user := range *req.Assignees {
+			if !repo.assignable[user] {
+				writeError(w, http.StatusUnprocessableEntity, "Invalid assignee")
+				return
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusCreated, x.fake.newIssue(repo, &req))
+}
+
+func (x *fakeGithubServer) lookupIssue(w http.ResponseWriter, repo *fakeRepo, number string) *github.Issue {
+	n, _ := strconv.Atoi(number)
+	issue, err := repo.lookupIssue(n)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return nil
+	}
+	return issue
+}
+
+func (x *fakeGithubServer) editIssue(w http.ResponseWriter, r *http.Request, repo *fakeRepo, args []string) {
+	issue := x.lookupIssue(w, repo, args[0])
+	if issue == nil {
+		return
+	}
+
+	var req github.IssueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	applyIssueRequest(issue, &req)
+	writeJSON(w, http.StatusOK, issue)
+}
+
+func (x *fakeGithubServer) addLabels(w http.ResponseWriter, r *http.Request, repo *fakeRepo, args []string) {
+	issue := x.lookupIssue(w, repo, args[0])
+	if issue == nil {
+		return
+	}
+
+	var labels []string
+	if err := json.NewDecoder(r.Body).Decode(&labels); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	repo.addLabels(issue, labels)
+	writeJSON(w, http.StatusOK, issue.Labels)
+}
+
+func (x *fakeGithubServer) removeLabel(w http.ResponseWriter, r *http.Request, repo *fakeRepo, args []string) {
+	issue := x.lookupIssue(w, repo, args[0])
+	if issue == nil {
+		return
+	}
+
+	repo.removeLabel(issue, args[1])
+	writeJSON(w, http.StatusOK, issue.Labels)
+}
+
+func (x *fakeGithubServer) createComment(w http.ResponseWriter, r *http.Request, repo *fakeRepo, args []string) {
+	issue := x.lookupIssue(w, repo, args[0])
+	if issue == nil {
+		return
+	}
+
+	var comment github.IssueComment
+	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	repo.comments[issue.GetNumber()] = append(repo.comments[issue.GetNumber()], comment.GetBody())
+	writeJSON(w, http.StatusCreated, &comment)
+}
+
+// listIssues supports only labels and state parameters
+func (x *fakeGithubServer) listIssues(w http.ResponseWriter, r *http.Request, repo *fakeRepo, args []string) {
+	var labels []string
+	if v := r.URL.Query().Get("labels"); v != "" {
+		labels = strings.Split(v, ",")
+	}
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		state = "open"
+	}
+
+	issues := []*github.Issue{}
+	issues = append(issues, repo.listIssues(labels, state)...)
+	writeJSON(w, http.StatusOK, issues)
+}
+
+func (x *fakeGithubServer) createProjectCard(w http.ResponseWriter, r *http.Request, column string) {
+	columnID, _ := strconv.ParseInt(column, 10, 64)
+
+	var opt github.ProjectCardOptions
+	if err := json.NewDecoder(r.Body).Decode(&opt); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	x.fake.cards[columnID] = append(x.fake.cards[columnID], opt.ContentID)
+	writeJSON(w, http.StatusCreated, &github.ProjectCard{ID: github.Int64(int64(len(x.fake.cards[columnID])))})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/deepalert/deepalert"
+	"github.com/google/go-github/v27/github"
+)
+
+// maxLabelLength is limit of label name length in GitHub
+const maxLabelLength = 50
+
+// safeLabel is attached to an issue closed by a report judged as safe
+const safeLabel = "resolved:safe"
+
+// reportLabelPrefix is prefix of a label to identify an issue of a report
+const reportLabelPrefix = "report:"
+
+type labelStyle struct {
+	prefix      string
+	color       string
+	description string
+}
+
+// labelStyles keeps consistent colors of generated labels by prefix
+var labelStyles = []labelStyle{
+	{prefix: "severity:urgent", color: "d73a4a", description: "deepalert: urgent severity"},
+	{prefix: "severity:unclassified", color: "fbca04", description: "deepalert: unclassified severity"},
+	{prefix: "severity:safe", color: "0e8a16", description: "deepalert: safe severity"},
+	{prefix: "severity:", color: "bfd4f2", description: "deepalert: severity"},
+	{prefix: "detector:", color: "1d76db", description: "deepalert: detector of alert"},
+	{prefix: "rule:", color: "5319e7", description: "deepalert: rule name of alert"},
+	{prefix: "attr:", color: "c5def5", description: "deepalert: attribute type in report"},
+	{prefix: safeLabel, color: "0e8a16", description: "deepalert: closed because judged as safe"},
+}
+
+func lookupLabelStyle(name string) labelStyle {
+	for _, style := range labelStyles {
+		if strings.HasPrefix(name, style.prefix) {
+			return style
+		}
+	}
+	return labelStyle{color: "ededed", description: "deepalert"}
+}
+
+func toLabel(prefix, value string) string {
+	label := prefix + strings.TrimSpace(value)
+	if r := []rune(label); len(r) > maxLabelLength {
+		label = string(r[:maxLabelLength])
+	}
+	return label
+}
+
+// reportLabel is attached to an issue to find it by listing issues. A report
+// ID longer than the limit is replaced with its hash not to be truncated.
+func reportLabel(reportID deepalert.ReportID) string {
+	label := reportLabelPrefix + string(reportID)
+	if len(label) > maxLabelLength {
+		label = fmt.Sprintf("%s%x", reportLabelPrefix, sha1.Sum([]byte(reportID)))
+	}
+	return label
+}
+
+// generatedLabelPrefixes are prefixes of labels derived from report content.
+// Labels without them are attached by analysts and must be kept.
+var generatedLabelPrefixes = []string{"severity:", "detector:", "rule:", "attr:"}
+
+// staleLabels returns generated labels of the issue not in labels anymore.
+func staleLabels(issue *github.Issue, labels []string) []string {
+	latest := map[string]struct{}{}
+	for _, name := range labels {
+		latest[strings.ToLower(name)] = struct{}{}
+	}
+
+	var stale []string
+	for _, label := range issue.Labels {
+		name := label.GetName()
+		if _, ok := latest[strings.ToLower(name)]; ok {
+			continue
+		}
+		for _, prefix := range generatedLabelPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				stale = append(stale, name)
+				break
+			}
+		}
+	}
+	return stale
+}
+
+// reportToLabels generates labels of an issue from the report content.
+func reportToLabels(report deepalert.Report) []string {
+	labelMap := map[string]struct{}{}
+	add := func(prefix, value string) {
+		if value != "" {
+			labelMap[toLabel(prefix, value)] = struct{}{}
+		}
+	}
+
+	add("severity:", string(report.Result.Severity))
+	for _, alert := range report.Alerts {
+		add("detector:", alert.Detector)
+		add("rule:", alert.RuleName)
+		for _, attr := range alert.Attributes {
+			add("attr:", string(attr.Type))
+		}
+	}
+	for _, attr := range report.Attributes {
+		add("attr:", string(attr.Type))
+	}
+
+	var labels []string
+	for label := range labelMap {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	return labels
+}
+
+// ensureLabels creates labels with consistent style. Labels are created
+// directly instead of listing all labels of the repository, and an existing
+// label is reported as 422 by GitHub.
+func ensureLabels(ctx context.Context, client *github.Client, owner, repo string, labels []string) error {
+	for _, name := range labels {
+		style := lookupLabelStyle(name)
+		label := &github.Label{
+			Name:        github.String(name),
+			Color:       github.String(style.color),
+			Description: github.String(style.description),
+		}
+		if _, resp, err := client.Issues.CreateLabel(ctx, owner, repo, label); err != nil {
+			if resp != nil && resp.StatusCode == 422 {
+				continue
+			}
+			return wrapGithubError(err, "Failed to create a label", resp).
+				With("owner", owner).
+				With("repo", repo).
+				With("label", name)
+		}
+		logger.With("label", name).Info("Created a label")
+	}
+
+	return nil
+}
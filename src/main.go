@@ -1,7 +1,15 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
 	"github.com/Netflix/go-env"
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/deepalert/deepalert"
 	"github.com/m-mizutani/golambda"
 )
@@ -12,48 +20,209 @@ type arguments struct {
 	SecretARN      string `env:"SECRET_ARN"`
 	GitHubEndpoint string `env:"GITHUB_ENDPOINT"`
 	GitHubRepo     string `env:"GITHUB_REPO"`
+	GitHubBranch   string `env:"GITHUB_BRANCH"`
+	GitHubRoutes   string `env:"GITHUB_ROUTES"`
+	GitHubAssign   string `env:"GITHUB_ASSIGN_RULES"`
+	RedactFields   string `env:"ARCHIVE_REDACT_FIELDS"`
+	TitleTemplate  string `env:"GITHUB_TITLE_TEMPLATE"`
+	BodyTemplate   string `env:"GITHUB_BODY_TEMPLATE"`
+	BodyTmplFile   string `env:"GITHUB_BODY_TEMPLATE_FILE"`
+	Defang         bool   `env:"GITHUB_DEFANG"`
+	EnrichLinks    string `env:"GITHUB_ENRICH_LINKS"`
+	DryRun         bool   `env:"DRY_RUN"`
 
 	NewSM golambda.SecretsManagerFactory
 }
 
-func handler(args arguments, event golambda.Event) error {
-	records, err := event.DecapSNSonSQSMessage()
+func (x arguments) loadSettings(cache *clientCache) (githubSettings, error) {
+	settings, err := cache.getSettings(x.SecretARN, x.NewSM)
+	if err != nil {
+		return githubSettings{}, err
+	}
+
+	settings.GithubEndpoint = x.GitHubEndpoint
+	settings.GithubRepo = x.GitHubRepo
+	if x.GitHubBranch != "" {
+		settings.GithubBranch = x.GitHubBranch
+	}
+	if x.GitHubRoutes != "" {
+		if err := json.Unmarshal([]byte(x.GitHubRoutes), &settings.GithubRoutes); err != nil {
+			return githubSettings{}, golambda.WrapError(err, "Failed to parse GITHUB_ROUTES").With("routes", x.GitHubRoutes)
+		}
+	}
+	if x.GitHubAssign != "" {
+		if err := json.Unmarshal([]byte(x.GitHubAssign), &settings.GithubAssignRules); err != nil {
+			return githubSettings{}, golambda.WrapError(err, "Failed to parse GITHUB_ASSIGN_RULES").With("rules", x.GitHubAssign)
+		}
+	}
+	if x.RedactFields != "" {
+		settings.ArchiveRedactFields = parseStringList(x.RedactFields)
+	}
+	// Template in environment variable is prior to a bundled template file
+	if x.BodyTmplFile != "" {
+		raw, err := ioutil.ReadFile(x.BodyTmplFile)
+		if err != nil {
+			return githubSettings{}, golambda.WrapError(err, "Failed to read GITHUB_BODY_TEMPLATE_FILE").With("path", x.BodyTmplFile)
+		}
+		settings.GithubBodyTemplate = string(raw)
+	}
+	if x.BodyTemplate != "" {
+		settings.GithubBodyTemplate = x.BodyTemplate
+	}
+	if x.Defang {
+		settings.GithubDefang = true
+	}
+	if x.EnrichLinks != "" {
+		if err := json.Unmarshal([]byte(x.EnrichLinks), &settings.GithubEnrichLinks); err != nil {
+			return githubSettings{}, golambda.WrapError(err, "Failed to parse GITHUB_ENRICH_LINKS").With("links", x.EnrichLinks)
+		}
+	}
+	if x.TitleTemplate != "" {
+		settings.GithubTitleTemplate = x.TitleTemplate
+	}
+	if _, err := parseTitleTemplate(settings.GithubTitleTemplate); err != nil {
+		return githubSettings{}, err
+	}
+	if _, err := parseBodyTemplate(settings.GithubBodyTemplate, bodyOptions{}); err != nil {
+		return githubSettings{}, err
+	}
+	if err := settings.GithubRoutes.validate(); err != nil {
+		return githubSettings{}, err
+	}
+
+	return settings, nil
+}
+
+// batchItemFailure and batchResponse are partial batch response of SQS event
+// source. Only failed messages are returned to the queue.
+type batchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+type batchResponse struct {
+	BatchItemFailures []batchItemFailure `json:"batchItemFailures"`
+}
+
+// recordToReport extracts a report from SQS message that is delivered from
+// SNS topic of deepalert.
+func recordToReport(record events.SQSMessage) (deepalert.Report, error) {
+	var snsEntity events.SNSEntity
+	if err := json.Unmarshal([]byte(record.Body), &snsEntity); err != nil {
+		return deepalert.Report{}, golambda.WrapError(err, "Failed to unmarshal SNS entity in SQS msg").With("body", record.Body)
+	}
+
+	var report deepalert.Report
+	if err := golambda.EventRecord(snsEntity.Message).Bind(&report); err != nil {
+		return deepalert.Report{}, err
+	}
+
+	return report, nil
+}
+
+func handleRecord(ctx context.Context, pub reportPublisher, settings githubSettings, record events.SQSMessage) error {
+	report, err := recordToReport(record)
 	if err != nil {
 		return err
 	}
 
-	for _, record := range records {
-		var report deepalert.Report
-		if err := record.Bind(&report); err != nil {
-			return err
+	if _, err := publishToGithub(ctx, pub, report, settings); err != nil {
+		return golambda.WrapError(err).With("reportID", report.ID)
+	}
+
+	return nil
+}
+
+func handler(args arguments, event golambda.Event) (*batchResponse, error) {
+	var sqsEvent events.SQSEvent
+	if err := event.Bind(&sqsEvent); err != nil {
+		return nil, err
+	}
+	if len(sqsEvent.Records) == 0 {
+		return nil, golambda.NewError("No SQS event records")
+	}
+
+	// Failure of settings or client affects all records, then retry whole batch
+	cache := defaultClientCache
+	settings, err := args.loadSettings(cache)
+	if err != nil {
+		return nil, err
+	}
+
+	// Dry run does not require credentials because GitHub API is never called
+	var pub reportPublisher = &dryRunPublisher{}
+	if !args.DryRun {
+		client, err := cache.getClient(settings)
+		if err != nil {
+			return nil, err
 		}
+		pub = &githubPublisher{api: &githubClient{client: client}}
+	}
+
+	// Lambda context has deadline of the invocation
+	ctx := event.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
 
-		var settings githubSettings
-		if err := golambda.GetSecretValuesWithFactory(args.SecretARN, &settings, args.NewSM); err != nil {
-			return err
+	return handleRecords(ctx, pub, settings, sqsEvent.Records, cache), nil
+}
+
+// handleRecords publishes reports of records one by one and returns failed
+// records as partial batch response.
+func handleRecords(ctx context.Context, pub reportPublisher, settings githubSettings, records []events.SQSMessage, cache *clientCache) *batchResponse {
+	resp := &batchResponse{BatchItemFailures: []batchItemFailure{}}
+	for _, record := range records {
+		err := handleRecord(ctx, pub, settings, record)
+		if err == nil {
+			continue
 		}
 
-		settings.GithubEndpoint = args.GitHubEndpoint
-		settings.GithubRepo = args.GitHubRepo
+		if isAuthError(err) {
+			logger.Info("Credentials are rejected, then drop cached secret and client")
+			cache.invalidate()
+		}
 
-		if _, err := publishToGithub(report, settings); err != nil {
-			return err
+		entry := logger.With("messageID", record.MessageId).
+			With("receiveCount", record.Attributes["ApproximateReceiveCount"]).
+			With("error", err.Error())
+		var e *golambda.Error
+		if errors.As(err, &e) {
+			entry = entry.With("error.values", e.Values())
 		}
+		entry.Error("Failed to handle a record")
+
+		resp.BatchItemFailures = append(resp.BatchItemFailures, batchItemFailure{
+			ItemIdentifier: record.MessageId,
+		})
 	}
 
-	return nil
+	logger.With("records", len(records)).
+		With("failures", len(resp.BatchItemFailures)).
+		Info("Handled records")
+
+	return resp
 }
 
 func main() {
+	// Subcommand is used only for local use, not in Lambda
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		if err := renderCommand(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	golambda.Start(func(event golambda.Event) (interface{}, error) {
 		var args arguments
 		if _, err := env.UnmarshalFromEnviron(&args); err != nil {
 			return nil, golambda.WrapError(err, "Failed to unmarshal env vars")
 		}
 
-		if err := handler(args, event); err != nil {
+		resp, err := handler(args, event)
+		if err != nil {
 			return nil, err
 		}
-		return nil, nil
+		return resp, nil
 	})
 }
@@ -12,6 +12,7 @@ import (
 	"github.com/deepalert/deepalert"
 	"github.com/google/uuid"
 	"github.com/m-mizutani/golambda"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	main "github.com/deepalert/deepalert-github/src"
@@ -155,7 +156,9 @@ func TestIntegration(t *testing.T) {
 
 	var event golambda.Event
 	require.NoError(t, event.EncapSNSonSQSMessage(report))
-	require.NoError(t, main.Handler(args, event))
+	failures, err := main.Handler(args, event)
+	require.NoError(t, err)
+	require.Empty(t, failures)
 }
 
 func TestWithEventData(t *testing.T) {
@@ -173,5 +176,42 @@ func TestWithEventData(t *testing.T) {
 	require.NoError(t, err)
 	var sqsEvent events.SQSEvent
 	require.NoError(t, json.Unmarshal(data, &sqsEvent))
-	require.NoError(t, main.Handler(args, golambda.Event{Origin: sqsEvent}))
+	failures, err := main.Handler(args, golambda.Event{Origin: sqsEvent})
+	require.NoError(t, err)
+	require.Empty(t, failures)
+}
+
+func TestHandlerPartialBatchFailure(t *testing.T) {
+	const secretARN = "arn:aws:secretsmanager:us-east-1:111122223333:secret:partial-batch"
+	mock, factory := golambda.NewSecretsManagerMock()
+	mock.Secrets[secretARN] = `{"github_token":"xxx"}`
+
+	args := main.Arguments{
+		SecretARN:  secretARN,
+		GitHubRepo: "blue/orange",
+		NewSM:      factory,
+	}
+
+	// A report without status is not published, then no GitHub API call
+	raw, err := json.Marshal(deepalert.Report{ID: "test-report"})
+	require.NoError(t, err)
+	validBody, err := json.Marshal(events.SNSEntity{Message: string(raw)})
+	require.NoError(t, err)
+	invalidBody, err := json.Marshal(events.SNSEntity{Message: "{broken"})
+	require.NoError(t, err)
+
+	event := golambda.Event{
+		Origin: events.SQSEvent{
+			Records: []events.SQSMessage{
+				{MessageId: "msg-1", Body: string(validBody)},
+				{MessageId: "msg-2", Body: string(invalidBody)},
+				{MessageId: "msg-3", Body: "not SNS entity"},
+				{MessageId: "msg-4", Body: string(validBody)},
+			},
+		},
+	}
+
+	failures, err := main.Handler(args, event)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"msg-2", "msg-3"}, failures)
 }
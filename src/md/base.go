@@ -31,6 +31,7 @@ func (x *Container) Render(w io.Writer) error {
 	return nil
 }
 
+// Literal is plain text. Markdown syntax and HTML in the text are escaped.
 type Literal string
 
 func ToLiteral(s string) *Literal {
@@ -44,6 +45,39 @@ func ToLiteralf(f string, v ...interface{}) *Literal {
 }
 
 func (x *Literal) Render(w io.Writer) error {
+	if _, err := w.Write([]byte(EscapeText(string(*x)))); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Text is untrusted free text such as description of alert. References that
+// notify or link by GitHub are neutralized in addition to escaping.
+type Text string
+
+func ToText(s string) *Text {
+	p := Text(s)
+	return &p
+}
+
+func (x *Text) Render(w io.Writer) error {
+	if _, err := w.Write([]byte(DefuseReferences(EscapeText(string(*x))))); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Raw is written as it is. It must not have untrusted data.
+type Raw string
+
+func ToRaw(s string) *Raw {
+	p := Raw(s)
+	return &p
+}
+
+func (x *Raw) Render(w io.Writer) error {
 	if _, err := w.Write([]byte(*x)); err != nil {
 		return err
 	}
@@ -0,0 +1,146 @@
+package md
+
+import (
+	"io"
+	"strings"
+	"unicode"
+)
+
+// textEscaper escapes HTML and inline markdown syntax in text. Pipe is escaped
+// by table cell because it is a special character only in a table.
+var textEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`\`, `\\`,
+	"`", "\\`",
+	"*", `\*`,
+	"[", `\[`,
+	"]", `\]`,
+	"~", `\~`,
+	"#", `\#`,
+	"\r\n", " ",
+	"\r", " ",
+	"\n", " ",
+)
+
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// escapeUnderscore escapes underscores except ones in a word such as
+// snake_case because they do not start emphasis in GitHub Flavored Markdown.
+func escapeUnderscore(s string) string {
+	if !strings.Contains(s, "_") {
+		return s
+	}
+
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if r == '_' {
+			inWord := i > 0 && i+1 < len(runes) && isWordChar(runes[i-1]) && isWordChar(runes[i+1])
+			if !inWord {
+				b.WriteString(`\_`)
+				continue
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// EscapeText escapes a string to be rendered as plain text in markdown.
+// Newlines are replaced with spaces not to start a new block.
+func EscapeText(s string) string {
+	return escapeUnderscore(textEscaper.Replace(s))
+}
+
+// longestRun returns the longest length of consecutive c in s
+func longestRun(s string, c rune) int {
+	longest, current := 0, 0
+	for _, r := range s {
+		if r == c {
+			current++
+			if current > longest {
+				longest = current
+			}
+		} else {
+			current = 0
+		}
+	}
+	return longest
+}
+
+// CodeSpan returns inline code of s. The fence is longer than any backtick
+// run in s so that s can not close the code span.
+func CodeSpan(s string) string {
+	s = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(s)
+	fence := strings.Repeat("`", longestRun(s, '`')+1)
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + s + fence
+}
+
+// allowedSchemes are URL schemes that can be linked. Relative URLs are also
+// allowed.
+var allowedSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+}
+
+// urlEscaper percent-encodes characters that can close link destination or
+// break table.
+var urlEscaper = strings.NewReplacer(
+	" ", "%20",
+	"\t", "%09",
+	"\r", "%0D",
+	"\n", "%0A",
+	"(", "%28",
+	")", "%29",
+	"<", "%3C",
+	">", "%3E",
+	"|", "%7C",
+	"`", "%60",
+	`"`, "%22",
+	"'", "%27",
+	`\`, "%5C",
+	"[", "%5B",
+	"]", "%5D",
+)
+
+// SanitizeURL returns URL that is safe as link destination. It returns empty
+// string if scheme of the URL is not allowed, e.g. javascript: or data:.
+func SanitizeURL(u string) string {
+	u = strings.TrimSpace(u)
+
+	// Browsers ignore control characters in scheme, e.g. "java\tscript:"
+	scheme := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, u)
+	if i := strings.IndexAny(scheme, ":/?#"); i >= 0 && scheme[i] == ':' {
+		if !allowedSchemes[strings.ToLower(scheme[:i])] {
+			return ""
+		}
+	}
+
+	return urlEscaper.Replace(u)
+}
+
+// pipeEscapeWriter escapes pipes written in a table cell
+type pipeEscapeWriter struct {
+	w io.Writer
+}
+
+func (x *pipeEscapeWriter) Write(p []byte) (int, error) {
+	escaped := strings.ReplaceAll(string(p), "|", `\|`)
+	if _, err := x.w.Write([]byte(escaped)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,74 @@
+package md_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/deepalert/deepalert-github/src/md"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func render(t *testing.T, node md.Node) string {
+	buf := new(bytes.Buffer)
+	require.NoError(t, node.Render(buf))
+	return buf.String()
+}
+
+func TestEscapeLiteral(t *testing.T) {
+	assert.Equal(t, `\*\*bold\*\* \[x\](javascript:alert(1)) &lt;img src=x&gt; \`+"`"+`code\`+"`",
+		render(t, md.ToLiteral("**bold** [x](javascript:alert(1)) <img src=x> `code`")))
+	assert.Equal(t, `\# line1 - item`, render(t, md.ToLiteral("# line1\n- item")))
+	assert.Equal(t, `snake_case \_emphasis\_ a\\b &amp;lt;`, render(t, md.ToLiteral(`snake_case _emphasis_ a\b &lt;`)))
+	assert.Equal(t, " **\\*\\*x** ", render(t, md.ToBold("**x")))
+}
+
+func TestRaw(t *testing.T) {
+	assert.Equal(t, "<!-- raw **x** -->\n", render(t, md.ToRaw("<!-- raw **x** -->\n")))
+}
+
+func TestCodeFence(t *testing.T) {
+	assert.Equal(t, " `abc` ", render(t, md.ToCode("abc")))
+	assert.Equal(t, " ``a`b`` ", render(t, md.ToCode("a`b")))
+	assert.Equal(t, " ``` ``x`` ``` ", render(t, md.ToCode("``x``")))
+	assert.Equal(t, " `a b` ", render(t, md.ToCode("a\nb")))
+	assert.Equal(t, "\n````json\n```\n````\n", render(t, md.ToCodeBlock("```")))
+}
+
+func TestTablePipe(t *testing.T) {
+	table := &md.Table{
+		Haed: md.TableHead{Cols: []md.TableCol{{Content: md.ToLiteral("a|b")}}},
+		Rows: []md.TableRow{
+			{Cols: []md.TableCol{{Content: md.ToCode("x|y")}}},
+		},
+	}
+	assert.Equal(t, "| a\\|b |\n|:------|\n|  `x\\|y`  |\n\n", render(t, table))
+}
+
+func TestLinkURL(t *testing.T) {
+	link := func(url string) string {
+		return render(t, &md.Link{Content: md.ToLiteral("text"), URL: url})
+	}
+	assert.Equal(t, "[text](https://example.com/a%20b%29)", link("https://example.com/a b)"))
+	assert.Equal(t, "[text](../tree/main/2021/)", link("../tree/main/2021/"))
+	assert.Equal(t, "[text](./x.md)", link("./x.md"))
+	assert.Equal(t, "text", link("javascript:alert(1)"))
+	assert.Equal(t, "text", link(" JavaScript:alert(1)"))
+	assert.Equal(t, "text", link("java\tscript:alert(1)"))
+	assert.Equal(t, "text", link("data:text/html;base64,xxx"))
+}
+
+func TestDefuseReferences(t *testing.T) {
+	const zwsp = "\u200b"
+	assert.Equal(t, "@"+zwsp+"org/security-team and @"+zwsp+"user", md.DefuseReferences("@org/security-team and @user"))
+	assert.Equal(t, "admin@example.com", md.DefuseReferences("admin@example.com"))
+	assert.Equal(t, "#"+zwsp+"1 GH-"+zwsp+"2 org/repo#"+zwsp+"3", md.DefuseReferences("#1 GH-2 org/repo#3"))
+	assert.Equal(t, "d39e48"+zwsp+"c19d1b"+zwsp+"c3", md.DefuseReferences("d39e48c19d1bc3"))
+	assert.Equal(t, "defaced abc123", md.DefuseReferences("defaced abc123"))
+	assert.Equal(t, "http://evil.example", md.DefuseReferences("http://evil.example"))
+
+	// Only free text is defused. Literal and code span are kept to be copied
+	assert.Equal(t, "\\#"+zwsp+"1 @"+zwsp+"team", render(t, md.ToText("#1 @team")))
+	assert.Equal(t, "\\#1 deadbeef01 2021-01-02 03:04:05.123456789", render(t, md.ToLiteral("#1 deadbeef01 2021-01-02 03:04:05.123456789")))
+	assert.Equal(t, " `#1 @team` ", render(t, md.ToCode("#1 @team")))
+}
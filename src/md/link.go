@@ -10,7 +10,16 @@ type Link struct {
 	URL     string
 }
 
+// Render writes only the content if the URL is not safe to be linked.
 func (x *Link) Render(w io.Writer) error {
+	url := SanitizeURL(x.URL)
+	if url == "" {
+		if x.Content == nil {
+			return nil
+		}
+		return x.Content.Render(w)
+	}
+
 	if _, err := w.Write([]byte("[")); err != nil {
 		return err
 	}
@@ -21,7 +30,7 @@ func (x *Link) Render(w io.Writer) error {
 		}
 	}
 
-	if _, err := w.Write([]byte(fmt.Sprintf("](%s)", x.URL))); err != nil {
+	if _, err := w.Write([]byte(fmt.Sprintf("](%s)", url))); err != nil {
 		return err
 	}
 
@@ -0,0 +1,71 @@
+package md
+
+import (
+	"regexp"
+	"strings"
+)
+
+// zeroWidthSpace is inserted to break references that GitHub links
+// automatically. It is not visible in rendered text.
+const zeroWidthSpace = "\u200b"
+
+var (
+	// #123 and GH-123, also owner/repo#123
+	issueRefPattern = regexp.MustCompile(`(#|(?i:\bgh)-)([0-9])`)
+	// Commit SHA. Hex words without digit such as "defaced" are not SHA
+	commitSHAPattern = regexp.MustCompile(`\b[0-9a-fA-F]{7,40}\b`)
+)
+
+// defuseMentions inserts zero width space after @ that starts a mention of
+// user or team. @ in email address (preceded by a word) is not a mention.
+func defuseMentions(s string) string {
+	if !strings.Contains(s, "@") {
+		return s
+	}
+
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		b.WriteRune(r)
+		if r != '@' || i+1 >= len(runes) {
+			continue
+		}
+		inWord := i > 0 && (isWordChar(runes[i-1]) || runes[i-1] == '_')
+		if !inWord && isASCIIAlnum(runes[i+1]) {
+			b.WriteString(zeroWidthSpace)
+		}
+	}
+	return b.String()
+}
+
+// isASCIIAlnum checks a rune that can start GitHub user or organization name
+func isASCIIAlnum(r rune) bool {
+	return ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')
+}
+
+func defuseCommitSHA(sha string) string {
+	if !strings.ContainsAny(sha, "0123456789") {
+		return sha
+	}
+
+	// Every chunk must be shorter than 7 characters that is minimum length
+	// of linked SHA
+	var chunks []string
+	for len(sha) > 6 {
+		chunks = append(chunks, sha[:6])
+		sha = sha[6:]
+	}
+	return strings.Join(append(chunks, sha), zeroWidthSpace)
+}
+
+// DefuseReferences neutralizes @mentions, issue references and commit SHAs
+// that GitHub converts to notification or link. It is applied only to free
+// text (Text) because the inserted characters break copying a value. Text
+// inside a code span is not converted by GitHub, then identifiers should be
+// rendered as Code.
+func DefuseReferences(s string) string {
+	s = defuseMentions(s)
+	s = issueRefPattern.ReplaceAllString(s, "${1}"+zeroWidthSpace+"${2}")
+	s = commitSHAPattern.ReplaceAllStringFunc(s, defuseCommitSHA)
+	return s
+}
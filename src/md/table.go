@@ -99,5 +99,5 @@ func (x *TableCol) Render(w io.Writer) error {
 	if x.Content == nil {
 		return nil
 	}
-	return x.Content.Render(w)
+	return x.Content.Render(&pipeEscapeWriter{w: w})
 }
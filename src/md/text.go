@@ -3,6 +3,7 @@ package md
 import (
 	"fmt"
 	"io"
+	"strings"
 )
 
 type Code string
@@ -13,7 +14,7 @@ func ToCode(s string) *Code {
 }
 
 func (x *Code) Render(w io.Writer) error {
-	c := fmt.Sprintf(" `%s` ", *x)
+	c := fmt.Sprintf(" %s ", CodeSpan(string(*x)))
 	if _, err := w.Write([]byte(c)); err != nil {
 		return err
 	}
@@ -29,7 +30,7 @@ func ToBold(s string) *Bold {
 }
 
 func (x *Bold) Render(w io.Writer) error {
-	c := fmt.Sprintf(" **%s** ", *x)
+	c := fmt.Sprintf(" **%s** ", EscapeText(string(*x)))
 	if _, err := w.Write([]byte(c)); err != nil {
 		return err
 	}
@@ -45,7 +46,7 @@ func ToItalic(s string) *Italic {
 }
 
 func (x *Italic) Render(w io.Writer) error {
-	c := fmt.Sprintf(" *%s* ", *x)
+	c := fmt.Sprintf(" *%s* ", EscapeText(string(*x)))
 	if _, err := w.Write([]byte(c)); err != nil {
 		return err
 	}
@@ -61,7 +62,12 @@ func ToCodeBlock(s string) *CodeBlock {
 }
 
 func (x *CodeBlock) Render(w io.Writer) error {
-	c := fmt.Sprintf("\n```json\n%s\n```\n", *x)
+	// Fence must be longer than backtick runs in the content
+	fence := "```"
+	if n := longestRun(string(*x), '`'); n >= len(fence) {
+		fence = strings.Repeat("`", n+1)
+	}
+	c := fmt.Sprintf("\n%sjson\n%s\n%s\n", fence, *x, fence)
 	if _, err := w.Write([]byte(c)); err != nil {
 		return err
 	}
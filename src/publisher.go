@@ -1,9 +1,7 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"crypto/sha1"
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
@@ -13,6 +11,7 @@ import (
 
 	"github.com/bradleyfalzon/ghinstallation"
 	"github.com/deepalert/deepalert"
+	"github.com/deepalert/deepalert-github/src/md"
 	"github.com/google/go-github/v27/github"
 	"github.com/m-mizutani/golambda"
 )
@@ -20,16 +19,66 @@ import (
 type githubSettings struct {
 	GithubEndpoint   string `json:"github_endpoint"`
 	GithubRepo       string `json:"github_repo"`
+	GithubBranch     string `json:"github_branch"`
 	GithubAppID      string `json:"github_app_id"`
 	GithubInstallID  string `json:"github_install_id"`
 	GithubPrivateKey string `json:"github_private_key"`
+	GithubToken      string `json:"github_token"`
+
+	GithubRoutes      routeRules  `json:"github_routes"`
+	GithubAssignRules assignRules `json:"github_assign_rules"`
+
+	// GithubTitleTemplate is text/template of issue title
+	GithubTitleTemplate string `json:"github_title_template"`
+	// GithubBodyTemplate is text/template of issue body
+	GithubBodyTemplate string `json:"github_body_template"`
+
+	// GithubDefang renders IP address, domain name and URL not to be clicked
+	GithubDefang bool `json:"github_defang"`
+	// GithubEnrichLinks are quick-pivot links of attribute values by type
+	GithubEnrichLinks enrichLinks `json:"github_enrich_links"`
+
+	// ArchiveRedactFields are JSON field paths to be masked in archived JSON
+	ArchiveRedactFields stringList `json:"archive_redact_fields"`
+
+	// fallbackRepo is GithubRepo before replaced by the routed repository
+	fallbackRepo string
+}
+
+// bodyOptions returns options to render issue body and alert files
+func (x githubSettings) bodyOptions(branch string) bodyOptions {
+	return bodyOptions{
+		Branch:      branch,
+		Template:    x.GithubBodyTemplate,
+		Defang:      x.GithubDefang,
+		EnrichLinks: x.GithubEnrichLinks,
+	}
 }
 
 func (x githubSettings) hasAppSettings() bool {
 	return (x.GithubAppID != "" && x.GithubInstallID != "" && x.GithubPrivateKey != "")
 }
 
+func (x githubSettings) hasTokenSettings() bool {
+	return x.GithubToken != ""
+}
+
 func (x githubSettings) newClient() (*github.Client, error) {
+	// GitHub App credentials take priority over token if both are available
+	switch {
+	case x.hasAppSettings():
+		return x.newAppClient()
+	case x.hasTokenSettings():
+		return newGithubTokenClient(x.GithubEndpoint, x.GithubToken)
+	default:
+		return nil, golambda.NewError("No complete GitHub credential in secret, either set of (github_app_id, github_install_id, github_private_key) or github_token is required").
+			With("hasAppID", x.GithubAppID != "").
+			With("hasInstallID", x.GithubInstallID != "").
+			With("hasPrivateKey", x.GithubPrivateKey != "")
+	}
+}
+
+func (x githubSettings) newAppClient() (*github.Client, error) {
 	appID, err := strconv.ParseInt(x.GithubAppID, 10, 64)
 	if err != nil {
 		return nil, golambda.WrapError(err, "Fail to parse appID").With("apID", x.GithubAppID)
@@ -49,7 +98,8 @@ func (x githubSettings) newClient() (*github.Client, error) {
 }
 
 func newGithubAppClient(endpoint string, appID int64, installID int64, privateKey []byte) (*github.Client, error) {
-	tr := http.DefaultTransport
+	// Retry is applied to also refreshing installation token
+	tr := newRetryTransport(http.DefaultTransport)
 
 	logger.With("appID", appID).
 		With("endpoint", endpoint).
@@ -61,13 +111,45 @@ func newGithubAppClient(endpoint string, appID int64, installID int64, privateKe
 	if err != nil {
 		return nil, golambda.WrapError(err, "Fail to create GH client").With("appID", appID).With("installID", installID)
 	}
+	if endpoint != "" {
+		itr.BaseURL = strings.TrimRight(endpoint, "/")
+	}
 
+	return newGithubClient(endpoint, itr)
+}
+
+// tokenTransport sets a personal access token (classic or fine-grained) to
+// Authorization header of each request.
+type tokenTransport struct {
+	token string
+	tr    http.RoundTripper
+}
+
+func (x *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTripper should not modify original request
+	newReq := req.Clone(req.Context())
+	newReq.Header.Set("Authorization", "token "+x.token)
+	return x.tr.RoundTrip(newReq)
+}
+
+func newGithubTokenClient(endpoint string, token string) (*github.Client, error) {
+	logger.With("endpoint", endpoint).
+		With("token.length", len(token)).
+		Debug("Creating github token client")
+
+	return newGithubClient(endpoint, &tokenTransport{
+		token: token,
+		tr:    newRetryTransport(http.DefaultTransport),
+	})
+}
+
+func newGithubClient(endpoint string, tr http.RoundTripper) (*github.Client, error) {
 	var client *github.Client
 	if endpoint == "" {
-		client = github.NewClient(&http.Client{Transport: itr})
+		client = github.NewClient(&http.Client{Transport: tr})
 	} else {
-		itr.BaseURL = strings.TrimLeft(endpoint, "/")
-		client, err = github.NewEnterpriseClient(endpoint, endpoint, &http.Client{Transport: itr})
+		var err error
+		client, err = github.NewEnterpriseClient(endpoint, endpoint, &http.Client{Transport: tr})
 		if err != nil {
 			return nil, golambda.WrapError(err).With("endpoint", endpoint)
 		}
@@ -78,142 +160,420 @@ func newGithubAppClient(endpoint string, appID int64, installID int64, privateKe
 	return client, nil
 }
 
-func reportToTitle(report deepalert.Report) string {
-	return fmt.Sprintf("[%s] %s: %s", report.Alerts[0].Detector, report.Alerts[0].RuleName, report.Alerts[0].Description)
+// reportPublisher writes alert files and issue of a report. publishToGithub
+// decides which operation is required by status and severity of the report.
+type reportPublisher interface {
+	publishAlert(ctx context.Context, report deepalert.Report, settings githubSettings) (string, error)
+	publishReport(ctx context.Context, report deepalert.Report, settings githubSettings) (*github.Issue, error)
+	closeReport(ctx context.Context, report deepalert.Report, settings githubSettings) (*github.Issue, error)
+}
+
+// githubPublisher is reportPublisher calling GitHub API
+type githubPublisher struct {
+	api githubAPI
 }
 
-func publishToGithub(report deepalert.Report, settings githubSettings) (*github.Issue, error) {
+func (x *githubPublisher) publishAlert(ctx context.Context, report deepalert.Report, settings githubSettings) (string, error) {
+	return publishAlert(ctx, x.api, report, settings)
+}
+
+func (x *githubPublisher) publishReport(ctx context.Context, report deepalert.Report, settings githubSettings) (*github.Issue, error) {
+	return publishReport(ctx, x.api, report, settings)
+}
+
+func (x *githubPublisher) closeReport(ctx context.Context, report deepalert.Report, settings githubSettings) (*github.Issue, error) {
+	return closeReport(ctx, x.api, report, settings)
+}
+
+func publishToGithub(ctx context.Context, pub reportPublisher, report deepalert.Report, settings githubSettings) (*github.Issue, error) {
 	logger.With("report", report).Info("Publishing report")
 	var issue *github.Issue
+	var err error
 
-	client, err := settings.newClient()
+	// Route rules are not applied to close issue of safe report because the
+	// issue may be published already by the report with a higher severity.
+	safe := report.Status == deepalert.StatusPublished && report.Result.Severity == deepalert.SevSafe
+	if safe {
+		issue, err = pub.closeReport(ctx, report, settings)
+		if err != nil {
+			return nil, err
+		}
+		if issue == nil {
+			logger.Info("Report is not published because the severity is safe")
+		}
+	}
+
+	route, err := settings.resolveRoute(report)
 	if err != nil {
 		return nil, err
 	}
+	if route.Action == routeDrop {
+		logger.With("route", route).Info("Report is dropped by route rule")
+		return issue, nil
+	}
+	logger.With("route", route).Debug("Resolved route")
+	// Both alert files and issue are published to the routed repository
+	settings.fallbackRepo = settings.GithubRepo
+	settings.GithubRepo = route.Repo
 
 	switch report.Status {
 	case deepalert.StatusNew:
 		fallthrough
 	case deepalert.StatusMore:
-		path, err := publishAlert(client, report, settings)
+		path, err := pub.publishAlert(ctx, report, settings)
 		if err != nil {
 			return nil, err
 		}
 		logger.With("path", path).Info("published alert")
 
 	case deepalert.StatusPublished:
-		if report.Result.Severity != deepalert.SevSafe {
-			issue, err = publishReport(client, report, settings)
+		// Alert archive is updated to record status and severity
+		path, err := pub.publishAlert(ctx, report, settings)
+		if err != nil {
+			return nil, err
+		}
+		logger.With("path", path).Info("updated alert archive")
+
+		if !safe {
+			issue, err = pub.publishReport(ctx, report, settings)
 			if err != nil {
 				return nil, err
 			}
 			logger.With("issue", issue).Info("publish only a 'published' report")
-		} else {
-			logger.Info("Report is not published because the severity is safe")
 		}
 	}
 
 	return issue, nil
 }
 
-func reportToPath(report deepalert.Report) string {
-	return fmt.Sprintf("%s/%s/", report.CreatedAt.Format("2006/01/02"), report.ID)
+// reportMarker is a hidden HTML comment embedded in an issue body to link the
+// issue with a deepalert report ID.
+func reportMarker(reportID deepalert.ReportID) string {
+	return fmt.Sprintf("<!-- deepalert-report-id: %s -->", reportID)
 }
 
-func publishAlert(client *github.Client, report deepalert.Report, settings githubSettings) (string, error) {
-	ctx := context.Background()
-	arr := strings.Split(settings.GithubRepo, "/")
-	owner := arr[0]
-	repo := arr[1]
-
-	for _, alert := range report.Alerts {
-		nodes := buildAlert(alert)
+func splitRepo(repoName string) (string, string, error) {
+	arr := strings.Split(repoName, "/")
+	if len(arr) != 2 || arr[0] == "" || arr[1] == "" {
+		return "", "", golambda.NewError("invalid repository format, must be {owner}/{repo_name}").With("repo", repoName)
+	}
+	return arr[0], arr[1], nil
+}
 
-		buf := new(bytes.Buffer)
-		for _, node := range nodes {
-			if err := node.Render(buf); err != nil {
-				return "", err
-			}
+func wrapGithubError(err error, msg string, resp *github.Response) *golambda.Error {
+	e := golambda.WrapError(err, msg)
+	if resp != nil {
+		e = e.With("code", resp.StatusCode)
+		if body, err := ioutil.ReadAll(resp.Body); err != nil {
+			e = e.With("read error", err)
+		} else {
+			e = e.With("body", body)
 		}
+	}
+	return e
+}
+
+// findIssue looks up an issue that has the report label and the hidden marker
+// of the report ID in the repositories. Issues are listed by the label instead
+// of Search API because search index is updated asynchronously and an issue
+// created just before can be missed. It returns nil without error if no issue
+// is found.
+func findIssue(ctx context.Context, client *github.Client, repos []string, reportID deepalert.ReportID) (*github.Issue, error) {
+	marker := reportMarker(reportID)
+	if len(repos) == 0 {
+		return nil, golambda.NewError("No repository to find issue").With("reportID", reportID)
+	}
 
-		data := buf.Bytes()
-		sha := sha1.Sum(data)
-		hv := fmt.Sprintf("%040x", sha)
-		opt := github.RepositoryContentFileOptions{
-			Message: github.String(fmt.Sprintf("[Alert] %s: %s", alert.RuleName, alert.Description)),
-			Content: data,
-			SHA:     github.String(hv),
-			Branch:  github.String("master"),
+	opt := &github.IssueListByRepoOptions{
+		State:  "all",
+		Labels: []string{reportLabel(reportID)},
+	}
+	for _, repoName := range repos {
+		owner, repo, err := splitRepo(repoName)
+		if err != nil {
+			return nil, err
 		}
-		dpath := reportToPath(report)
-		fpath := fmt.Sprintf("%s%s_%s.md", dpath,
-			alert.Timestamp.Format("20060102_150405"), hv)
-		content, resp, err := client.Repositories.CreateFile(ctx, owner, repo, fpath, &opt)
+
+		issues, resp, err := client.Issues.ListByRepo(ctx, owner, repo, opt)
 		if err != nil {
-			if strings.Contains(err.Error(), ": 409 ") {
-				logger.With("owner", arr[0]).
-					With("repo", arr[1]).
-					With("content", content).
-					With("fpath", fpath).Info("409 error (conflicted) is returned, but ignore")
-				return "", nil
+			// Repository of other route may not exist or be accessible
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				continue
 			}
+			return nil, wrapGithubError(err, "Failed to list issues", resp).
+				With("repo", repoName).
+				With("label", reportLabel(reportID))
+		}
 
-			e := golambda.NewError("Failed to create a file").
-				With("owner", arr[0]).
-				With("repo", arr[1]).
-				With("content", content).
-				With("fpath", fpath)
-			if resp != nil {
-				e = e.With("code", resp.StatusCode)
-				if body, err := ioutil.ReadAll(resp.Body); err != nil {
-					e = e.With("read error", err)
-				} else {
-					e = e.With("body", body)
-				}
+		// Label can be attached by hand. Then check the marker strictly
+		for _, issue := range issues {
+			if !issue.IsPullRequest() && strings.Contains(issue.GetBody(), marker) {
+				return issue, nil
 			}
-			return "", e
 		}
 	}
-	return "", nil
+
+	return nil, nil
+}
+
+// issueRepo extracts owner and repository name of the issue from its
+// repository URL such as https://api.github.com/repos/{owner}/{repo}
+func issueRepo(issue *github.Issue) (string, string, error) {
+	arr := strings.Split(strings.TrimRight(issue.GetRepositoryURL(), "/"), "/")
+	if len(arr) < 2 {
+		return "", "", golambda.NewError("Invalid repository URL of issue").With("url", issue.GetRepositoryURL())
+	}
+	return splitRepo(strings.Join(arr[len(arr)-2:], "/"))
+}
+
+// issueContent is title, body, labels and placement of an issue for a report
+type issueContent struct {
+	Title     string
+	Body      string
+	Labels    []string
+	Placement *issuePlacement
+	// FullBody is whole issue body to be committed as fullBodyPath if Body is
+	// truncated by size limit. Empty if Body is not truncated.
+	FullBody string
+}
+
+func buildIssueContent(report deepalert.Report, settings githubSettings, branch string) (*issueContent, error) {
+	title, err := reportToTitle(report, settings.GithubTitleTemplate)
+	if err != nil {
+		return nil, err
+	}
+	placement := settings.GithubAssignRules.resolve(report)
+
+	// Mentions and marker are kept even if body is truncated
+	suffix := placement.mentionText() + reportMarker(report.ID) + "\n"
+	body, full, err := buildIssueBody(report, settings.bodyOptions(branch), suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &issueContent{
+		Title:     title,
+		Body:      body,
+		Labels:    append(reportToLabels(report), reportLabel(report.ID)),
+		Placement: placement,
+		FullBody:  full,
+	}, nil
 }
 
-func publishReport(client *github.Client, report deepalert.Report, settings githubSettings) (*github.Issue, error) {
-	title := reportToTitle(report)
-	buf, err := reportToBody(report)
+func publishReport(ctx context.Context, api githubAPI, report deepalert.Report, settings githubSettings) (*github.Issue, error) {
+	owner, repo, err := splitRepo(settings.GithubRepo)
 	if err != nil {
 		return nil, err
 	}
-	body := buf.String()
 
-	ctx := context.Background()
+	// Branch is required for links to alert files from issue body
+	branch, err := api.resolveBranch(ctx, owner, repo, settings.GithubBranch)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := buildIssueContent(report, settings, branch)
+	if err != nil {
+		return nil, err
+	}
+	title, body, labels, placement := content.Title, content.Body, content.Labels, content.Placement
+
+	// Full body is committed before the issue links to it
+	if content.FullBody != "" {
+		if err := commitFullBody(ctx, api, owner, repo, branch, report, content.FullBody); err != nil {
+			return nil, err
+		}
+	}
+
 	issueReq := github.IssueRequest{
 		Title: github.String(title),
 		Body:  github.String(body),
 	}
-	arr := strings.Split(settings.GithubRepo, "/")
-	if len(arr) != 2 {
-		return nil, golambda.NewError("invalid repository format, must be {owner}/{repo_name}").With("repo", settings.GithubRepo)
+
+	// Label of report ID is left to GitHub that creates it on attaching to
+	// avoid an extra request per report
+	if err := api.ensureLabels(ctx, owner, repo, reportToLabels(report)); err != nil {
+		return nil, err
 	}
 
-	issue, resp, err := client.Issues.Create(ctx, arr[0], arr[1], &issueReq)
+	// Issue may be published to another repository by an earlier report of
+	// the same ID if the route is changed by severity
+	current, err := api.findIssue(ctx, settings.candidateRepos(), report.ID)
 	if err != nil {
-		e := golambda.NewError("Failed to create an issue").
-			With("owner", arr[0]).
-			With("repo", arr[1])
-		if resp != nil {
-			e = e.With("code", resp.StatusCode)
-			if body, err := ioutil.ReadAll(resp.Body); err != nil {
-				e = e.With("read error", err)
-			} else {
-				e = e.With("body", body)
+		return nil, err
+	}
+
+	var moved *github.Issue
+	if current != nil {
+		curOwner, curRepo, err := issueRepo(current)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(curOwner+"/"+curRepo, owner+"/"+repo) {
+			moved, current = current, nil
+		}
+	}
+
+	if current != nil {
+		// Labels are added instead of replaced to keep labels attached by
+		// analysts, and only outdated generated labels are removed
+		for _, name := range staleLabels(current, labels) {
+			if err := api.removeLabel(ctx, owner, repo, current.GetNumber(), name); err != nil {
+				return nil, err
 			}
 		}
-		return nil, e
+		if err := api.addLabels(ctx, owner, repo, current.GetNumber(), labels); err != nil {
+			return nil, err
+		}
+
+		// Issue closed by an earlier safe report is reopened because the
+		// report is judged as not safe again
+		reopen := current.GetState() == "closed"
+		if reopen {
+			if err := api.removeLabel(ctx, owner, repo, current.GetNumber(), safeLabel); err != nil {
+				return nil, err
+			}
+			issueReq.State = github.String("open")
+		}
+
+		if !reopen && current.GetTitle() == title && current.GetBody() == body {
+			logger.With("number", current.GetNumber()).Info("Issue is up to date, skip updating")
+			return current, nil
+		}
+
+		issue, err := api.editIssue(ctx, owner, repo, current.GetNumber(), &issueReq)
+		if err != nil {
+			return nil, err
+		}
+
+		logger.With("number", issue.GetNumber()).With("reopen", reopen).Info("Updated existing issue")
+		return issue, nil
 	}
 
-	if resp.StatusCode != 201 {
-		return nil, golambda.NewError("Fail to create issue because response code is not 201").With("code", resp.StatusCode)
+	// Assignees, milestone and project are set only to a new issue not to
+	// override triage by analysts
+	issueReq.Labels = &labels
+	if assignees := api.validAssignees(ctx, owner, repo, placement.Assignees); len(assignees) > 0 {
+		issueReq.Assignees = &assignees
+	}
+	if placement.Milestone > 0 {
+		issueReq.Milestone = github.Int(placement.Milestone)
+	}
+
+	issue, err := api.createIssue(ctx, owner, repo, &issueReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if placement.ProjectColumnID != 0 {
+		api.addProjectCard(ctx, placement.ProjectColumnID, issue)
+	}
+
+	if moved != nil {
+		if err := closeMovedIssue(ctx, api, report.ID, moved, owner+"/"+repo, issue); err != nil {
+			return nil, err
+		}
+	}
+
+	return issue, nil
+}
+
+// closeMovedIssue closes an issue published to other repository with a link
+// to the new issue. The report label is removed not to be found again.
+func closeMovedIssue(ctx context.Context, api githubAPI, reportID deepalert.ReportID, moved *github.Issue, newRepo string, issue *github.Issue) error {
+	owner, repo, err := issueRepo(moved)
+	if err != nil {
+		return err
+	}
+	number := moved.GetNumber()
+
+	comment := fmt.Sprintf("This report has been moved to %s#%d by change of severity.\n", newRepo, issue.GetNumber())
+	if err := api.createComment(ctx, owner, repo, number, comment); err != nil {
+		return err
+	}
+
+	if err := api.removeLabel(ctx, owner, repo, number, reportLabel(reportID)); err != nil {
+		return err
+	}
+
+	if moved.GetState() != "closed" {
+		if _, err := api.editIssue(ctx, owner, repo, number, &github.IssueRequest{
+			State: github.String("closed"),
+		}); err != nil {
+			return err
+		}
+	}
+
+	logger.With("from", moved.GetRepositoryURL()).With("number", number).
+		With("to", newRepo).With("newNumber", issue.GetNumber()).
+		Info("Closed issue moved to other repository")
+	return nil
+}
+
+// commitFullBody commits whole issue body to the alert archive when the issue
+// body is truncated by size limit
+func commitFullBody(ctx context.Context, api githubAPI, owner, repo, branch string, report deepalert.Report, full string) error {
+	file := archiveFile{Path: fullBodyPath(report), Data: []byte(full)}
+	build := func(headSHA string) ([]archiveFile, error) {
+		return []archiveFile{file}, nil
+	}
+
+	commit, err := api.commitFiles(ctx, owner, repo, branch, fullBodyCommitMessage(report), build)
+	if err != nil {
+		return err
+	}
+
+	logger.With("commit", commit).With("path", file.Path).Info("Committed full issue body")
+	return nil
+}
+
+func safeComment(report deepalert.Report) string {
+	return fmt.Sprintf("This report has been judged as **%s**.\n\nReason: %s\n",
+		md.EscapeText(string(report.Result.Severity)), md.DefuseReferences(md.EscapeText(report.Result.Reason)))
+}
+
+// closeReport closes an issue published by an earlier report of the same ID
+// with a comment of the reason and resolved:safe label. It returns nil if no
+// issue has been published for the report.
+func closeReport(ctx context.Context, api githubAPI, report deepalert.Report, settings githubSettings) (*github.Issue, error) {
+	current, err := api.findIssue(ctx, settings.candidateRepos(), report.ID)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, nil
+	}
+
+	owner, repo, err := issueRepo(current)
+	if err != nil {
+		return nil, err
+	}
+	number := current.GetNumber()
+
+	if current.GetState() == "closed" {
+		logger.With("number", number).Info("Issue of safe report is already closed")
+		return current, nil
+	}
+
+	labels := []string{safeLabel}
+	if err := api.ensureLabels(ctx, owner, repo, labels); err != nil {
+		return nil, err
+	}
+	if err := api.addLabels(ctx, owner, repo, number, labels); err != nil {
+		return nil, err
+	}
+
+	if err := api.createComment(ctx, owner, repo, number, safeComment(report)); err != nil {
+		return nil, err
+	}
+
+	issue, err := api.editIssue(ctx, owner, repo, number, &github.IssueRequest{
+		State: github.String("closed"),
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	logger.With("number", number).Info("Closed issue because the report is judged as safe")
 	return issue, nil
 }
@@ -0,0 +1,351 @@
+package main_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deepalert/deepalert"
+	"github.com/google/go-github/v27/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/deepalert/deepalert-github/src"
+)
+
+func newTestReport() deepalert.Report {
+	return deepalert.Report{
+		ID:     deepalert.ReportID("c0ffee00-1234-5678-9abc-def012345678"),
+		Status: deepalert.StatusPublished,
+		Result: deepalert.ReportResult{
+			Severity: deepalert.SevUnclassified,
+			Reason:   "It's test",
+		},
+		Alerts: []*deepalert.Alert{
+			{
+				Detector:    "blue",
+				RuleName:    "orange",
+				AlertKey:    "five",
+				Description: "not sane",
+				Timestamp:   time.Now(),
+			},
+		},
+	}
+}
+
+func newTestClient(t *testing.T, mux *http.ServeMux) *github.Client {
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(srv.URL + "/")
+	require.NoError(t, err)
+	client.BaseURL = baseURL
+	return client
+}
+
+func handleRepository(mux *http.ServeMux, repo, defaultBranch string) {
+	mux.HandleFunc("/repos/"+repo, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"full_name":%q,"default_branch":%q}`, repo, defaultBranch)
+	})
+}
+
+func TestPublishReportCreateIssue(t *testing.T) {
+	report := newTestReport()
+	var created github.IssueRequest
+	var createdLabels []string
+
+	mux := http.NewServeMux()
+	handleRepository(mux, "blue/orange", "main")
+	mux.HandleFunc("/repos/blue/orange/labels", func(w http.ResponseWriter, r *http.Request) {
+		// All labels must not be listed
+		assert.Equal(t, "POST", r.Method)
+		var label github.Label
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&label)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		assert.NotEmpty(t, label.GetColor())
+		if strings.EqualFold(label.GetName(), "Severity:Unclassified") {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"message":"Validation Failed"}`)
+			return
+		}
+		createdLabels = append(createdLabels, label.GetName())
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/repos/blue/orange/issues", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			assert.Equal(t, "report:"+string(report.ID), r.URL.Query().Get("labels"))
+			assert.Equal(t, "all", r.URL.Query().Get("state"))
+			fmt.Fprint(w, `[]`)
+		case "POST":
+			if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&created)) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"number":1}`)
+		}
+	})
+
+	client := newTestClient(t, mux)
+	issue, err := main.PublishReport(client, report, main.GithubSettings{GithubRepo: "blue/orange"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, issue.GetNumber())
+	assert.Equal(t, "[blue] orange: not sane", created.GetTitle())
+	assert.Contains(t, created.GetBody(), main.ReportMarker(report.ID))
+	assert.Contains(t, created.GetBody(), "[link](../tree/main/")
+	assert.Equal(t, []string{"detector:blue", "rule:orange", "severity:unclassified", "report:" + string(report.ID)}, created.GetLabels())
+	assert.Equal(t, []string{"detector:blue", "rule:orange"}, createdLabels)
+}
+
+func TestPublishReportUpdateIssue(t *testing.T) {
+	report := newTestReport()
+	var edited github.IssueRequest
+	var addedLabels []string
+
+	mux := http.NewServeMux()
+	handleRepository(mux, "blue/orange", "main")
+	mux.HandleFunc("/repos/blue/orange/labels", func(w http.ResponseWriter, r *http.Request) {
+		// All labels exist already
+		assert.Equal(t, "POST", r.Method)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `{"message":"Validation Failed"}`)
+	})
+	mux.HandleFunc("/repos/blue/orange/issues/5/labels", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&addedLabels)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/blue/orange/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Error("new issue must not be created")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		items := []map[string]interface{}{
+			// The label is attached by hand, but the marker is not found
+			{"number": 3, "title": "other", "body": "refer " + string(report.ID)},
+			{
+				"number":         5,
+				"title":          "old",
+				"repository_url": "https://api.github.com/repos/blue/orange",
+				"body":           "old body\n" + main.ReportMarker(report.ID),
+			},
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(items))
+	})
+	mux.HandleFunc("/repos/blue/orange/issues/5", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "PATCH", r.Method)
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&edited)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"number":5}`)
+	})
+
+	client := newTestClient(t, mux)
+	issue, err := main.PublishReport(client, report, main.GithubSettings{GithubRepo: "blue/orange"})
+	require.NoError(t, err)
+	assert.Equal(t, 5, issue.GetNumber())
+	assert.Equal(t, "[blue] orange: not sane", edited.GetTitle())
+	assert.True(t, strings.HasSuffix(edited.GetBody(), main.ReportMarker(report.ID)+"\n"))
+	assert.Nil(t, edited.Labels)
+	assert.Equal(t, []string{"detector:blue", "rule:orange", "severity:unclassified", "report:" + string(report.ID)}, addedLabels)
+}
+
+func TestNewClientWithToken(t *testing.T) {
+	var authHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader = r.Header.Get("Authorization")
+		assert.Equal(t, "/repos/blue/orange", r.URL.Path)
+		fmt.Fprint(w, `{"full_name":"blue/orange"}`)
+	}))
+	defer srv.Close()
+
+	settings := main.GithubSettings{
+		GithubEndpoint: srv.URL,
+		GithubToken:    "github_pat_xxx",
+	}
+	client, err := settings.NewClient()
+	require.NoError(t, err)
+
+	repo, _, err := client.Repositories.Get(context.Background(), "blue", "orange")
+	require.NoError(t, err)
+	assert.Equal(t, "blue/orange", repo.GetFullName())
+	assert.Equal(t, "token github_pat_xxx", authHeader)
+}
+
+func TestNewClientWithoutCredential(t *testing.T) {
+	t.Run("no credential", func(t *testing.T) {
+		_, err := main.GithubSettings{}.NewClient()
+		assert.Error(t, err)
+	})
+
+	t.Run("incomplete app credential", func(t *testing.T) {
+		_, err := main.GithubSettings{
+			GithubAppID:     "1234",
+			GithubInstallID: "5678",
+		}.NewClient()
+		assert.Error(t, err)
+	})
+}
+
+func TestPublishReportWithAssignRules(t *testing.T) {
+	report := newTestReport()
+	var created github.IssueRequest
+	var card github.ProjectCardOptions
+
+	mux := http.NewServeMux()
+	handleRepository(mux, "blue/orange", "main")
+	mux.HandleFunc("/repos/blue/orange/labels", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/repos/blue/orange/assignees/alice", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/repos/blue/orange/assignees/mallory", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/repos/blue/orange/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fmt.Fprint(w, `[]`)
+			return
+		}
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&created)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":1234,"number":1}`)
+	})
+	mux.HandleFunc("/projects/columns/42/cards", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&card)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+
+	var settings main.GithubSettings
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"github_repo": "blue/orange",
+		"github_assign_rules": [
+			{"detector": "blue", "assignees": ["alice", "mallory"], "mentions": ["org/sec"], "milestone": 3},
+			{"severity": "unclassified", "assignees": ["alice"], "milestone": 5, "project_column_id": 42},
+			{"severity": "urgent", "assignees": ["bob"]}
+		]
+	}`), &settings))
+
+	client := newTestClient(t, mux)
+	_, err := main.PublishReport(client, report, settings)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"alice"}, created.GetAssignees())
+	assert.Equal(t, 3, created.GetMilestone())
+	assert.Contains(t, created.GetBody(), "cc: @org/sec\n")
+	assert.Equal(t, int64(1234), card.ContentID)
+	assert.Equal(t, "Issue", card.ContentType)
+}
+
+func TestCloseReport(t *testing.T) {
+	report := newTestReport()
+	report.Result = deepalert.ReportResult{
+		Severity: deepalert.SevSafe,
+		Reason:   "false positive",
+	}
+	var comment github.IssueComment
+	var edited github.IssueRequest
+	var addedLabels []string
+
+	mux := http.NewServeMux()
+	var listed []string
+	mux.HandleFunc("/repos/blue/orange/issues", func(w http.ResponseWriter, r *http.Request) {
+		listed = append(listed, "blue/orange")
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/blue/oncall/issues", func(w http.ResponseWriter, r *http.Request) {
+		listed = append(listed, "blue/oncall")
+		assert.NoError(t, json.NewEncoder(w).Encode([]map[string]interface{}{
+			{
+				"number":         7,
+				"state":          "open",
+				"repository_url": "https://api.github.com/repos/blue/oncall",
+				"body":           "body\n" + main.ReportMarker(report.ID),
+			},
+		}))
+	})
+	mux.HandleFunc("/repos/blue/oncall/labels", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `{"message":"Validation Failed"}`)
+	})
+	mux.HandleFunc("/repos/blue/oncall/issues/7/labels", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&addedLabels)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/blue/oncall/issues/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&comment)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/repos/blue/oncall/issues/7", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "PATCH", r.Method)
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&edited)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"number":7,"state":"closed"}`)
+	})
+
+	var settings main.GithubSettings
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"github_repo": "blue/orange",
+		"github_routes": [{"severity": "urgent", "repo": "blue/oncall"}]
+	}`), &settings))
+
+	client := newTestClient(t, mux)
+	issue, err := main.CloseReport(client, report, settings)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"blue/orange", "blue/oncall"}, listed)
+	assert.Equal(t, "closed", issue.GetState())
+	assert.Equal(t, "closed", edited.GetState())
+	assert.Equal(t, []string{"resolved:safe"}, addedLabels)
+	assert.Contains(t, comment.GetBody(), "false positive")
+}
+
+func TestCloseReportNotPublished(t *testing.T) {
+	report := newTestReport()
+	report.Result.Severity = deepalert.SevSafe
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/blue/orange/issues", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+
+	client := newTestClient(t, mux)
+	issue, err := main.CloseReport(client, report, main.GithubSettings{GithubRepo: "blue/orange"})
+	require.NoError(t, err)
+	assert.Nil(t, issue)
+}
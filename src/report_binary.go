@@ -6,7 +6,56 @@ import (
 )
 
 func buildBinaryInspections(binaries []*deepalert.ContentBinary,
-	attr deepalert.Attribute) (nodes []md.Node) {
-	// ToDo: Not yet implemented
-	return nil
+	attr deepalert.Attribute, opt bodyOptions) (nodes []md.Node) {
+
+	if len(binaries) == 0 {
+		return
+	}
+
+	for _, binary := range binaries {
+		nodes = append(nodes, &md.Heading{
+			Level:   2,
+			Content: md.Contents{md.ToLiteral("Binary: "), md.ToCode(attr.Value)},
+		})
+
+		nodes = append(nodes, buildReportBinaryBaseSection(binary, attr)...)
+		nodes = append(nodes, buildReportHostMalwareSection(binary.RelatedMalware, opt)...)
+		nodes = append(nodes, buildActivitiesSection(binary.Activities, opt)...)
+	}
+
+	return
+}
+
+func buildReportBinaryBaseSection(binary *deepalert.ContentBinary, attr deepalert.Attribute) []md.Node {
+	type itemSet struct {
+		title string
+		items []string
+	}
+	targets := []itemSet{
+		{title: "OS: ", items: binary.OS},
+		{title: "Software: ", items: binary.Software},
+	}
+
+	list := md.List{}
+	if attr.Type == deepalert.TypeFileHashValue {
+		list.Items = append(list.Items, md.ListItem{Content: md.Contents{
+			md.ToLiteral("Hash: "),
+			md.ToCode(attr.Value),
+		}})
+	}
+
+	for _, target := range targets {
+		if len(target.items) > 0 {
+			listContents := md.Contents{md.ToLiteral(target.title)}
+			listContents = append(listContents, joinAsCode(target.items)...)
+
+			list.Items = append(list.Items, md.ListItem{Content: listContents})
+		}
+	}
+
+	if len(list.Items) == 0 {
+		return []md.Node{md.ToRaw("N/A\n\n")}
+	}
+
+	return []md.Node{&list}
 }
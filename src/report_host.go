@@ -1,14 +1,14 @@
 package main
 
 import (
-	"fmt"
+	"sort"
 
 	"github.com/deepalert/deepalert"
 	"github.com/deepalert/deepalert-github/src/md"
 )
 
 func buildHostInspections(hosts []*deepalert.ContentHost,
-	attr deepalert.Attribute) (nodes []md.Node) {
+	attr deepalert.Attribute, opt bodyOptions) (nodes []md.Node) {
 
 	if len(hosts) == 0 {
 		return
@@ -17,15 +17,15 @@ func buildHostInspections(hosts []*deepalert.ContentHost,
 	for _, host := range hosts {
 		nodes = append(nodes, &md.Heading{
 			Level:   2,
-			Content: md.ToLiteral(fmt.Sprintf("Host: %s", attr.Value)),
+			Content: md.Contents{md.ToLiteral("Host: "), md.ToCode(opt.attrValue(&attr))},
 		})
 
-		nodes = append(nodes, buildReportHostBaseSection(host)...)
-		nodes = append(nodes, buildActivitiesSection(host.Activities)...)
-		nodes = append(nodes, buildReportHostDomainSection(host.RelatedDomains)...)
-		nodes = append(nodes, buildReportHostURLSection(host.RelatedURLs)...)
-		nodes = append(nodes, buildReportHostMalwareSection(host.RelatedMalware)...)
-		nodes = append(nodes, buildReportHostSoftwareSection(host.Software)...)
+		nodes = append(nodes, buildReportHostBaseSection(host, opt)...)
+		nodes = append(nodes, buildActivitiesSection(host.Activities, opt)...)
+		nodes = append(nodes, buildReportHostDomainSection(host.RelatedDomains, opt)...)
+		nodes = append(nodes, buildReportHostURLSection(host.RelatedURLs, opt)...)
+		nodes = append(nodes, buildReportHostMalwareSection(host.RelatedMalware, opt)...)
+		nodes = append(nodes, buildReportHostSoftwareSection(host.Software, opt)...)
 
 		if len(nodes) == 1 {
 			nodes = append(nodes, md.ToLiteral("N/A"))
@@ -55,13 +55,13 @@ func mergeReportHost(contents []deepalert.ContentHost) (merged deepalert.Content
 	return
 }
 
-func buildReportHostBaseSection(merged *deepalert.ContentHost) []md.Node {
+func buildReportHostBaseSection(merged *deepalert.ContentHost, opt bodyOptions) []md.Node {
 	type itemSet struct {
 		title string
 		items []string
 	}
 	targets := []itemSet{
-		{title: "IPAddr: ", items: merged.IPAddr},
+		{title: "IPAddr: ", items: defangAll(merged.IPAddr, defangIPAddr, opt)},
 		{title: "Country: ", items: merged.Country},
 		{title: "ASOwner: ", items: merged.ASOwner},
 		{title: "UserName: ", items: merged.UserName},
@@ -84,46 +84,7 @@ func buildReportHostBaseSection(merged *deepalert.ContentHost) []md.Node {
 	return []md.Node{&list}
 }
 
-func buildReportHostActivitiesSection(activities []deepalert.EntityActivity) (nodes []md.Node) {
-	if len(activities) == 0 {
-		return
-	}
-
-	table := md.Table{
-		Haed: md.TableHead{
-			Cols: []md.TableCol{
-				{Content: md.ToLiteral("LastSeen")},
-				{Content: md.ToLiteral("ServiceName")},
-				{Content: md.ToLiteral("RemoteAddr")},
-				{Content: md.ToLiteral("Principal")},
-				{Content: md.ToLiteral("Action")},
-				{Content: md.ToLiteral("Target")},
-			},
-		},
-	}
-
-	for _, act := range activities {
-		table.Rows = append(table.Rows, md.TableRow{
-			Cols: []md.TableCol{
-				{Content: md.ToLiteral(act.LastSeen.Format(timeFormat))},
-				{Content: md.ToLiteral(act.ServiceName)},
-				{Content: md.ToLiteral(act.RemoteAddr)},
-				{Content: md.ToLiteral(act.Principal)},
-				{Content: md.ToLiteral(act.Action)},
-				{Content: md.ToLiteral(act.Target)},
-			},
-		})
-	}
-
-	nodes = append(nodes, []md.Node{
-		&md.Heading{Level: 3, Content: md.ToLiteral("Activities")},
-		&table,
-	}...)
-
-	return
-}
-
-func buildReportHostDomainSection(activities []deepalert.EntityDomain) (nodes []md.Node) {
+func buildReportHostDomainSection(activities []deepalert.EntityDomain, opt bodyOptions) (nodes []md.Node) {
 	if len(activities) == 0 {
 		return
 	}
@@ -142,12 +103,14 @@ func buildReportHostDomainSection(activities []deepalert.EntityDomain) (nodes []
 		table.Rows = append(table.Rows, md.TableRow{
 			Cols: []md.TableCol{
 				{Content: md.ToLiteral(act.Timestamp.Format(timeFormat))},
-				{Content: md.ToLiteral(act.Name)},
-				{Content: md.ToLiteral(act.Source)},
+				{Content: append(md.Contents{toCodeOrEmpty(opt.defang(act.Name, defangDomain))},
+					buildEnrichLinks(deepalert.TypeDomainName, "", act.Name, opt)...)},
+				{Content: md.ToText(act.Source)},
 			},
 		})
 	}
 
+	limitTableRows(&table, opt)
 	nodes = append(nodes, []md.Node{
 		&md.Heading{Level: 3, Content: md.ToLiteral("Related Domains")},
 		&table,
@@ -156,7 +119,7 @@ func buildReportHostDomainSection(activities []deepalert.EntityDomain) (nodes []
 	return
 }
 
-func buildReportHostURLSection(activities []deepalert.EntityURL) (nodes []md.Node) {
+func buildReportHostURLSection(activities []deepalert.EntityURL, opt bodyOptions) (nodes []md.Node) {
 	if len(activities) == 0 {
 		return
 	}
@@ -176,13 +139,15 @@ func buildReportHostURLSection(activities []deepalert.EntityURL) (nodes []md.Nod
 		table.Rows = append(table.Rows, md.TableRow{
 			Cols: []md.TableCol{
 				{Content: md.ToLiteral(act.Timestamp.Format(timeFormat))},
-				{Content: md.ToLiteral(act.URL)},
-				{Content: md.ToLiteral(act.Reference)},
-				{Content: md.ToLiteral(act.Source)},
+				{Content: append(md.Contents{toCodeOrEmpty(opt.defang(act.URL, defangURL))},
+					buildEnrichLinks(deepalert.TypeURL, "", act.URL, opt)...)},
+				{Content: md.ToText(act.Reference)},
+				{Content: md.ToText(act.Source)},
 			},
 		})
 	}
 
+	limitTableRows(&table, opt)
 	nodes = append(nodes, []md.Node{
 		&md.Heading{Level: 3, Content: md.ToLiteral("Related URLs")},
 		&table,
@@ -191,7 +156,7 @@ func buildReportHostURLSection(activities []deepalert.EntityURL) (nodes []md.Nod
 	return
 }
 
-func buildReportHostMalwareSection(malware []deepalert.EntityMalware) (nodes []md.Node) {
+func buildReportHostMalwareSection(malware []deepalert.EntityMalware, opt bodyOptions) (nodes []md.Node) {
 	if len(malware) == 0 {
 		return
 	}
@@ -206,19 +171,22 @@ func buildReportHostMalwareSection(malware []deepalert.EntityMalware) (nodes []m
 	for vender := range venderMap {
 		venders = append(venders, vender)
 	}
+	// Keep order of columns to render same body for same report
+	sort.Strings(venders)
 
 	// Build table head entities
 	table := md.Table{
 		Haed: md.TableHead{
 			Cols: []md.TableCol{
 				{Content: md.ToLiteral("Timestamp")},
+				{Content: md.ToLiteral("SHA256")},
 				{Content: md.ToLiteral("Relation")},
 			},
 		},
 	}
 	for _, vender := range venders {
 		table.Haed.Cols = append(table.Haed.Cols, md.TableCol{
-			Content: md.ToLiteral(vender),
+			Content: md.ToText(vender),
 			Align:   md.AlignCenter,
 		})
 	}
@@ -229,14 +197,16 @@ func buildReportHostMalwareSection(malware []deepalert.EntityMalware) (nodes []m
 		row := md.TableRow{
 			Cols: []md.TableCol{
 				{Content: md.ToLiteral(act.Timestamp.Format(timeFormat))},
-				{Content: md.ToLiteral(act.Relation)},
+				{Content: append(md.Contents{md.ToCode(act.SHA256)},
+					buildEnrichLinks(deepalert.TypeFileHashValue, "", act.SHA256, opt)...)},
+				{Content: md.ToText(act.Relation)},
 			},
 		}
 		for _, vendor := range venders {
 			var col *md.TableCol
 			for _, scan := range act.Scans {
 				if scan.Vendor == vendor {
-					col = &md.TableCol{Content: md.ToLiteral(scan.Name)}
+					col = &md.TableCol{Content: md.ToText(scan.Name)}
 					break
 				}
 			}
@@ -251,6 +221,7 @@ func buildReportHostMalwareSection(malware []deepalert.EntityMalware) (nodes []m
 		table.Rows = append(table.Rows, row)
 	}
 
+	limitTableRows(&table, opt)
 	nodes = append(nodes, []md.Node{
 		&md.Heading{Level: 3, Content: md.ToLiteral("Related Malware")},
 		&table,
@@ -259,7 +230,7 @@ func buildReportHostMalwareSection(malware []deepalert.EntityMalware) (nodes []m
 	return
 }
 
-func buildReportHostSoftwareSection(activities []deepalert.EntitySoftware) (nodes []md.Node) {
+func buildReportHostSoftwareSection(activities []deepalert.EntitySoftware, opt bodyOptions) (nodes []md.Node) {
 	if len(activities) == 0 {
 		return
 	}
@@ -278,12 +249,13 @@ func buildReportHostSoftwareSection(activities []deepalert.EntitySoftware) (node
 		table.Rows = append(table.Rows, md.TableRow{
 			Cols: []md.TableCol{
 				{Content: md.ToLiteral(act.LastSeen.Format(timeFormat))},
-				{Content: md.ToLiteral(act.Name)},
-				{Content: md.ToLiteral(act.Location)},
+				{Content: md.ToText(act.Name)},
+				{Content: md.ToText(act.Location)},
 			},
 		})
 	}
 
+	limitTableRows(&table, opt)
 	nodes = append(nodes, []md.Node{
 		&md.Heading{Level: 3, Content: md.ToLiteral("Installed Software")},
 		&table,
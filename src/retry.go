@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryTransport retries an idempotent request on transient errors (network
+// error and 5xx) with bounded exponential backoff, and any request on rate
+// limit responses after waiting for Retry-After or X-RateLimit-Reset. It gives up retrying if the
+// wait exceeds deadline of request context, e.g. remaining time of Lambda.
+type retryTransport struct {
+	tr         http.RoundTripper
+	maxRetry   int
+	baseWait   time.Duration
+	maxWait    time.Duration
+	maxLimWait time.Duration
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func newRetryTransport(tr http.RoundTripper) *retryTransport {
+	return &retryTransport{
+		tr:         tr,
+		maxRetry:   4,
+		baseWait:   500 * time.Millisecond,
+		maxWait:    8 * time.Second,
+		maxLimWait: time.Minute,
+		now:        time.Now,
+		sleep:      sleepWithContext,
+	}
+}
+
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (x *retryTransport) backoff(attempt int) time.Duration {
+	wait := x.baseWait << uint(attempt)
+	if wait <= 0 || wait > x.maxWait {
+		wait = x.maxWait
+	}
+	// Equal jitter, half of wait plus random up to half, to avoid retrying at
+	// same time by concurrent Lambda
+	half := wait / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// rateLimitWait returns duration to wait for rate limit reset if the
+// response is rejected by rate limit, secondary rate limit or abuse detection.
+func (x *retryTransport) rateLimitWait(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if sec, err := strconv.Atoi(v); err == nil {
+			return time.Duration(sec) * time.Second, true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return t.Sub(x.now()), true
+		}
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return time.Unix(reset, 0).Sub(x.now()) + time.Second, true
+		}
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// idempotentMethods can be retried on transient errors. POST, e.g. creating
+// an issue or a comment, may be done by the server even if the response is
+// lost or 5xx, then it is not retried not to be duplicated.
+var idempotentMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodHead:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+func (x *retryTransport) retryWait(attempt int, req *http.Request, resp *http.Response, err error) (time.Duration, bool) {
+	if err != nil {
+		if !idempotentMethods[req.Method] {
+			return 0, false
+		}
+		return x.backoff(attempt), true
+	}
+
+	if wait, ok := x.rateLimitWait(resp); ok {
+		if wait <= 0 {
+			wait = x.backoff(attempt)
+		}
+		if wait > x.maxLimWait {
+			return 0, false
+		}
+		return wait, true
+	}
+
+	if !idempotentMethods[req.Method] {
+		return 0, false
+	}
+
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return x.backoff(attempt), true
+	}
+
+	return 0, false
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (x *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(ctx)
+			r.Body = body
+		}
+
+		resp, err := x.tr.RoundTrip(r)
+		if ctx.Err() != nil {
+			return resp, err
+		}
+
+		wait, retry := x.retryWait(attempt, req, resp, err)
+		if !retry || attempt >= x.maxRetry || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && x.now().Add(wait).After(deadline) {
+			logger.With("url", req.URL.String()).
+				With("wait", wait.String()).
+				With("deadline", deadline).
+				Info("Give up retrying because of deadline")
+			return resp, err
+		}
+
+		entry := logger.With("url", req.URL.String()).
+			With("method", req.Method).
+			With("attempt", attempt+1).
+			With("wait", wait.String())
+		if err != nil {
+			entry = entry.With("error", err.Error())
+		}
+		if resp != nil {
+			entry = entry.With("code", resp.StatusCode)
+			// Drain body to reuse connection
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		entry.Info("Retrying GitHub API request")
+
+		if err := x.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/deepalert/deepalert-github/src"
+)
+
+type sleepRecorder struct {
+	waits []time.Duration
+}
+
+func (x *sleepRecorder) sleep(ctx context.Context, d time.Duration) error {
+	x.waits = append(x.waits, d)
+	return nil
+}
+
+func TestRetryTransportServerError(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, err := ioutil.ReadAll(r.Body)
+		if !assert.NoError(t, err) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		bodies = append(bodies, string(raw))
+		if len(bodies) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest("PATCH", srv.URL, strings.NewReader(`{"title":"x"}`))
+	require.NoError(t, err)
+
+	rec := &sleepRecorder{}
+	client := &http.Client{Transport: main.NewRetryTransport(http.DefaultTransport, rec.sleep)}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{`{"title":"x"}`, `{"title":"x"}`, `{"title":"x"}`}, bodies)
+	assert.Equal(t, 2, len(rec.waits))
+}
+
+func TestRetryTransportRateLimit(t *testing.T) {
+	t.Run("Retry-After", func(t *testing.T) {
+		count := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			if count == 1 {
+				w.Header().Set("Retry-After", "3")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+
+		rec := &sleepRecorder{}
+		client := &http.Client{Transport: main.NewRetryTransport(http.DefaultTransport, rec.sleep)}
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, []time.Duration{3 * time.Second}, rec.waits)
+	})
+
+	t.Run("give up by deadline", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer srv.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+		require.NoError(t, err)
+
+		rec := &sleepRecorder{}
+		client := &http.Client{Transport: main.NewRetryTransport(http.DefaultTransport, rec.sleep)}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Empty(t, rec.waits)
+	})
+
+	t.Run("not retry client error", func(t *testing.T) {
+		count := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer srv.Close()
+
+		rec := &sleepRecorder{}
+		client := &http.Client{Transport: main.NewRetryTransport(http.DefaultTransport, rec.sleep)}
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, 1, count)
+	})
+}
+
+func TestRetryTransportNotIdempotent(t *testing.T) {
+	t.Run("not retry POST on server error", func(t *testing.T) {
+		count := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer srv.Close()
+
+		rec := &sleepRecorder{}
+		client := &http.Client{Transport: main.NewRetryTransport(http.DefaultTransport, rec.sleep)}
+		resp, err := client.Post(srv.URL, "application/json", strings.NewReader(`{"title":"x"}`))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+		assert.Equal(t, 1, count)
+		assert.Empty(t, rec.waits)
+	})
+
+	t.Run("retry POST on rate limit", func(t *testing.T) {
+		count := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			if count == 1 {
+				w.Header().Set("Retry-After", "3")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer srv.Close()
+
+		rec := &sleepRecorder{}
+		client := &http.Client{Transport: main.NewRetryTransport(http.DefaultTransport, rec.sleep)}
+		resp, err := client.Post(srv.URL, "application/json", strings.NewReader(`{"title":"x"}`))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, 2, count)
+		assert.Equal(t, []time.Duration{3 * time.Second}, rec.waits)
+	})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/deepalert/deepalert"
+	"github.com/m-mizutani/golambda"
+)
+
+// reportMatcher matches a report by severity, detector and rule name. Empty
+// field matches any value.
+type reportMatcher struct {
+	Severity deepalert.ReportSeverity `json:"severity,omitempty"`
+	Detector string                   `json:"detector,omitempty"`
+	RuleName string                   `json:"rule_name,omitempty"`
+}
+
+func (x reportMatcher) match(report deepalert.Report) bool {
+	if x.Severity != "" && x.Severity != report.Result.Severity {
+		return false
+	}
+
+	if x.Detector == "" && x.RuleName == "" {
+		return true
+	}
+
+	for _, alert := range report.Alerts {
+		if (x.Detector == "" || x.Detector == alert.Detector) &&
+			(x.RuleName == "" || x.RuleName == alert.RuleName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type routeAction string
+
+const (
+	routePublish routeAction = "publish"
+	routeDrop    routeAction = "drop"
+)
+
+// routeRule decides a repository to publish a matched report. Rules are
+// evaluated in order and the first matched rule is used.
+type routeRule struct {
+	reportMatcher
+	Repo   string      `json:"repo,omitempty"`
+	Action routeAction `json:"action,omitempty"`
+}
+
+// unmarshalEmbeddedJSON decodes either JSON value or string of JSON value
+// because a value of SecretsManager's key/value secret must be string.
+func unmarshalEmbeddedJSON(data []byte, v interface{}) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		if s == "" {
+			return nil
+		}
+		data = []byte(s)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return golambda.WrapError(err, "Failed to parse JSON").With("data", string(data))
+	}
+	return nil
+}
+
+type routeRules []routeRule
+
+func (x *routeRules) UnmarshalJSON(data []byte) error {
+	var rules []routeRule
+	if err := unmarshalEmbeddedJSON(data, &rules); err != nil {
+		return err
+	}
+	*x = rules
+	return nil
+}
+
+func (x routeRules) validate() error {
+	for i, rule := range x {
+		switch rule.Action {
+		case "", routePublish:
+		case routeDrop:
+		default:
+			return golambda.NewError("Invalid route action, must be 'publish' or 'drop'").
+				With("index", i).With("action", rule.Action)
+		}
+	}
+	return nil
+}
+
+// resolveRoute returns a route rule for the report. If no rule matches, the
+// report is published to GithubRepo as fallback.
+func (x githubSettings) resolveRoute(report deepalert.Report) (*routeRule, error) {
+	route := routeRule{Repo: x.GithubRepo, Action: routePublish}
+
+	for _, rule := range x.GithubRoutes {
+		if rule.match(report) {
+			route = rule
+			break
+		}
+	}
+
+	if route.Action == "" {
+		route.Action = routePublish
+	}
+
+	if route.Action == routePublish {
+		if route.Repo == "" {
+			route.Repo = x.GithubRepo
+		}
+		if _, _, err := splitRepo(route.Repo); err != nil {
+			return nil, err
+		}
+	}
+
+	return &route, nil
+}
+
+// candidateRepos returns all repositories that can have an issue of a report.
+func (x githubSettings) candidateRepos() []string {
+	var repos []string
+	if _, _, err := splitRepo(x.GithubRepo); err == nil {
+		repos = appendUniq(repos, x.GithubRepo)
+	}
+	for _, rule := range x.GithubRoutes {
+		if _, _, err := splitRepo(rule.Repo); err == nil {
+			repos = appendUniq(repos, rule.Repo)
+		}
+	}
+	if _, _, err := splitRepo(x.fallbackRepo); err == nil {
+		repos = appendUniq(repos, x.fallbackRepo)
+	}
+	return repos
+}
@@ -0,0 +1,63 @@
+package main_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/deepalert/deepalert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/deepalert/deepalert-github/src"
+)
+
+func TestResolveRoute(t *testing.T) {
+	var settings main.GithubSettings
+	// github_routes in secret can be JSON string
+	secret := `{
+		"github_repo": "sec/fallback",
+		"github_routes": "[{\"severity\":\"urgent\",\"repo\":\"sec/oncall\"},{\"detector\":\"noisy\",\"action\":\"drop\"},{\"severity\":\"unclassified\",\"rule_name\":\"orange\",\"repo\":\"sec/triage\"}]"
+	}`
+	require.NoError(t, json.Unmarshal([]byte(secret), &settings))
+
+	newReport := func(sev deepalert.ReportSeverity, detector, rule string) deepalert.Report {
+		return deepalert.Report{
+			Result: deepalert.ReportResult{Severity: sev},
+			Alerts: []*deepalert.Alert{{Detector: detector, RuleName: rule}},
+		}
+	}
+
+	testCases := []struct {
+		title  string
+		report deepalert.Report
+		repo   string
+		drop   bool
+	}{
+		{"severity", newReport(deepalert.SevUrgent, "blue", "orange"), "sec/oncall", false},
+		{"drop action", newReport(deepalert.SevUnclassified, "noisy", "orange"), "", true},
+		{"severity and rule", newReport(deepalert.SevUnclassified, "blue", "orange"), "sec/triage", false},
+		{"fallback", newReport(deepalert.SevUnclassified, "blue", "red"), "sec/fallback", false},
+		{"no severity yet", newReport("", "blue", "orange"), "sec/fallback", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			repo, drop, err := settings.ResolveRoute(tc.report)
+			require.NoError(t, err)
+			assert.Equal(t, tc.drop, drop)
+			if !tc.drop {
+				assert.Equal(t, tc.repo, repo)
+			}
+		})
+	}
+}
+
+func TestResolveRouteInvalidRepo(t *testing.T) {
+	settings := main.GithubSettings{}
+	require.NoError(t, json.Unmarshal([]byte(`{"github_routes":[{"detector":"blue","repo":"invalid"}]}`), &settings))
+
+	_, _, err := settings.ResolveRoute(deepalert.Report{
+		Alerts: []*deepalert.Alert{{Detector: "blue"}},
+	})
+	assert.Error(t, err)
+}
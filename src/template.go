@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/deepalert/deepalert"
+	"github.com/deepalert/deepalert-github/src/md"
+	"github.com/m-mizutani/golambda"
+)
+
+// defaultBodyTemplate renders the same layout as issue body without template
+const defaultBodyTemplate = `{{ summary . }}{{ inspections . }}{{ rawValues . }}{{ systemInfo . }}`
+
+// bodyTemplateData is passed to issue body template as "."
+type bodyTemplateData struct {
+	Report deepalert.Report
+	// Branch has alert files of the report
+	Branch string
+	// AlertsURL is relative URL to directory of alert files from the issue
+	AlertsURL string
+
+	opt bodyOptions
+}
+
+func renderString(nodes ...md.Node) (string, error) {
+	raw, err := renderNodes(nodes)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+func toAttribute(v interface{}) (*deepalert.Attribute, error) {
+	switch attr := v.(type) {
+	case *deepalert.Attribute:
+		return attr, nil
+	case deepalert.Attribute:
+		return &attr, nil
+	default:
+		return nil, golambda.NewError("Not attribute").With("value", v)
+	}
+}
+
+// bodyTemplateFuncs returns helper functions of issue body template.
+// Functions named by section of default layout render the same markdown.
+func bodyTemplateFuncs(opt bodyOptions) template.FuncMap {
+	return template.FuncMap{
+		"summary": func(data *bodyTemplateData) (string, error) {
+			return renderString(buildSummary(data.Report, data.opt)...)
+		},
+		"inspections": func(data *bodyTemplateData) (string, error) {
+			return renderString(buildInspections(data.Report, data.opt)...)
+		},
+		// rawValues renders original values of defanged values. It is empty if
+		// defang mode is disabled.
+		"rawValues": func(data *bodyTemplateData) (string, error) {
+			return renderString(buildRawSection(reportRawValues(data.Report), data.opt)...)
+		},
+		"systemInfo": func(data *bodyTemplateData) (string, error) {
+			return renderString(buildSystemReport(data.Report)...)
+		},
+		// section renders inspection results of hosts, users and binaries
+		"section": func(section *deepalert.Section) (string, error) {
+			return renderString(buildSection(section, opt)...)
+		},
+		// attr renders "key (type): value" of an attribute
+		"attr": func(v interface{}) (string, error) {
+			attr, err := toAttribute(v)
+			if err != nil {
+				return "", err
+			}
+			return renderString(attrToContents(attr, opt))
+		},
+		// attrList renders a list of attributes
+		"attrList": func(v interface{}) (string, error) {
+			list := &md.List{}
+			switch attrs := v.(type) {
+			case []*deepalert.Attribute:
+				for _, attr := range attrs {
+					list.Items = append(list.Items, md.ListItem{Content: attrToContents(attr, opt)})
+				}
+			case []deepalert.Attribute:
+				for i := range attrs {
+					list.Items = append(list.Items, md.ListItem{Content: attrToContents(&attrs[i], opt)})
+				}
+			default:
+				return "", golambda.NewError("Not attribute list").With("value", v)
+			}
+			return renderString(list)
+		},
+		// text escapes a value as free text. It is added to actions that do
+		// not end with a markdown helper, e.g. {{ .Report.Result.Reason }}
+		"text": func(v interface{}) string {
+			return md.DefuseReferences(md.EscapeText(fmt.Sprint(v)))
+		},
+		// raw writes a value without escaping. It must not have untrusted data.
+		"raw": func(v interface{}) string {
+			return fmt.Sprint(v)
+		},
+		"heading": func(level int, s string) (string, error) {
+			return renderString(&md.Heading{Level: level, Content: md.ToText(s)})
+		},
+		"code": func(s string) (string, error) {
+			return renderString(md.ToCode(s))
+		},
+		"bold": func(s string) (string, error) {
+			return renderString(md.ToBold(md.DefuseReferences(s)))
+		},
+		"link": func(text, url string) (string, error) {
+			return renderString(&md.Link{Content: md.ToText(text), URL: url})
+		},
+		// table renders rows with header. Use with list, e.g.
+		// {{ table (list "Key" "Value") (list "a" "b") }}
+		"table": func(header []string, rows ...[]string) (string, error) {
+			table := &md.Table{}
+			for _, h := range header {
+				table.Haed.Cols = append(table.Haed.Cols, md.TableCol{Content: md.ToText(h)})
+			}
+			for _, row := range rows {
+				var cols []md.TableCol
+				for _, v := range row {
+					cols = append(cols, md.TableCol{Content: md.ToText(v)})
+				}
+				table.Rows = append(table.Rows, md.TableRow{Cols: cols})
+			}
+			return renderString(table)
+		},
+		"list": func(values ...string) []string {
+			return values
+		},
+		"join": strings.Join,
+		"formatTime": func(t time.Time) string {
+			return t.Format(timeFormat)
+		},
+	}
+}
+
+func parseBodyTemplate(text string, opt bodyOptions) (*template.Template, error) {
+	if text == "" {
+		text = defaultBodyTemplate
+	}
+
+	tmpl, err := template.New("body").Funcs(bodyTemplateFuncs(opt)).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, golambda.WrapError(err, "Failed to parse issue body template")
+	}
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			escapeActions(t.Tree.Root)
+		}
+	}
+	return tmpl, nil
+}
+
+// markdownFuncs are helpers that return markdown escaped by themselves
+var markdownFuncs = map[string]bool{
+	"summary":     true,
+	"inspections": true,
+	"rawValues":   true,
+	"systemInfo":  true,
+	"section":     true,
+	"attr":        true,
+	"attrList":    true,
+	"text":        true,
+	"raw":         true,
+	"heading":     true,
+	"code":        true,
+	"bold":        true,
+	"link":        true,
+	"table":       true,
+}
+
+// escapeActions appends text to pipeline of every action that writes output
+// and does not end with a markdown helper, as html/template does. Then
+// {{ .Report.Result.Reason }} is rendered as {{ .Report.Result.Reason | text }}.
+func escapeActions(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			escapeActions(child)
+		}
+	case *parse.IfNode:
+		escapeActions(n.List)
+		escapeActions(n.ElseList)
+	case *parse.RangeNode:
+		escapeActions(n.List)
+		escapeActions(n.ElseList)
+	case *parse.WithNode:
+		escapeActions(n.List)
+		escapeActions(n.ElseList)
+	case *parse.ActionNode:
+		pipe := n.Pipe
+		// Assignment such as {{ $x := .Value }} writes nothing
+		if len(pipe.Decl) > 0 || len(pipe.Cmds) == 0 {
+			return
+		}
+		last := pipe.Cmds[len(pipe.Cmds)-1]
+		if ident, ok := last.Args[0].(*parse.IdentifierNode); ok && markdownFuncs[ident.Ident] {
+			return
+		}
+		pipe.Cmds = append(pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Args:     []parse.Node{parse.NewIdentifier("text").SetTree(nil).SetPos(n.Pos)},
+		})
+	}
+}
+
+func executeBodyTemplate(report deepalert.Report, opt bodyOptions) (*bytes.Buffer, error) {
+	tmpl, err := parseBodyTemplate(opt.Template, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &bodyTemplateData{
+		Report:    report,
+		Branch:    opt.Branch,
+		AlertsURL: alertsURL(report, opt),
+		opt:       opt,
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return nil, golambda.WrapError(err, "Failed to execute issue body template").With("reportID", report.ID)
+	}
+	return buf, nil
+}
+
+func alertsURL(report deepalert.Report, opt bodyOptions) string {
+	return fmt.Sprintf("../tree/%s/%s", opt.Branch, reportToPath(report))
+}
@@ -0,0 +1,114 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/deepalert/deepalert"
+	"github.com/m-mizutani/golambda"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/deepalert/deepalert-github/src"
+)
+
+func TestBodyTemplate(t *testing.T) {
+	report := newTestReport()
+	report.Attributes = []*deepalert.Attribute{
+		{Type: deepalert.TypeIPAddr, Key: "src", Value: "10.1.2.3"},
+	}
+
+	t.Run("default template keeps layout", func(t *testing.T) {
+		buf, err := main.ReportToBody(report, main.BodyOptions{Branch: "main"})
+		require.NoError(t, err)
+		body := buf.String()
+		assert.Contains(t, body, "# Summary")
+		assert.Contains(t, body, "../tree/main/")
+		assert.Contains(t, body, "# Inspection Reports")
+		assert.Contains(t, body, "System Info")
+	})
+
+	t.Run("custom template", func(t *testing.T) {
+		tmpl := `{{ heading 2 "Overview" }}` +
+			`Severity: {{ bold (print .Report.Result.Severity) }}` + "\n" +
+			`{{ range .Report.Attributes }}- {{ attr . }}` + "\n" + `{{ end }}` +
+			`{{ table (list "Detector" "Rule") (list (index .Report.Alerts 0).Detector (index .Report.Alerts 0).RuleName) }}` +
+			`{{ link "alerts" .AlertsURL }}`
+		buf, err := main.ReportToBody(report, main.BodyOptions{Branch: "alerts", Template: tmpl})
+		require.NoError(t, err)
+		body := buf.String()
+		assert.Contains(t, body, "## Overview")
+		assert.Contains(t, body, "Severity:  **unclassified** ")
+		assert.Contains(t, body, "- src ( `ipaddr` ):  `10.1.2.3` ")
+		assert.Contains(t, body, "| Detector | Rule |\n")
+		assert.Contains(t, body, "| blue | orange |\n")
+		assert.Contains(t, body, "[alerts](../tree/alerts/")
+		assert.NotContains(t, body, "# Summary")
+	})
+
+	t.Run("output of action is escaped by default", func(t *testing.T) {
+		r := report
+		r.Result.Reason = "<b>**x**</b> @team #1"
+		tmpl := `R: {{ .Report.Result.Reason }}` + "\n" +
+			`P: {{ .Report.Result.Reason | printf "%s!" }}` + "\n" +
+			`{{ $r := .Report.Result.Reason }}V: {{ $r }}` + "\n" +
+			`{{ range .Report.Alerts }}D: {{ .Description }}{{ end }}` + "\n" +
+			`{{ define "sub" }}S: {{ . }}{{ end }}{{ template "sub" .Report.Result.Reason }}` + "\n" +
+			`T: {{ text .Report.Result.Reason }}` + "\n" +
+			`{{ raw "**raw**" }}`
+		buf, err := main.ReportToBody(r, main.BodyOptions{Template: tmpl})
+		require.NoError(t, err)
+		body := buf.String()
+		escaped := "&lt;b&gt;\\*\\*x\\*\\*&lt;/b&gt; @\u200bteam \\#\u200b1"
+		assert.Contains(t, body, "R: "+escaped+"\n")
+		assert.Contains(t, body, "P: "+escaped+"!\n")
+		assert.Contains(t, body, "V: "+escaped+"\n")
+		assert.Contains(t, body, "D: not sane\n")
+		assert.Contains(t, body, "S: "+escaped+"\n")
+		assert.Contains(t, body, "T: "+escaped+"\n")
+		assert.Contains(t, body, "**raw**")
+		assert.NotContains(t, body, "<b>")
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		_, err := main.ReportToBody(report, main.BodyOptions{Template: "{{ summary . "})
+		assert.Error(t, err)
+		_, err = main.ReportToBody(report, main.BodyOptions{Template: "{{ .NoSuchField }}"})
+		assert.Error(t, err)
+	})
+}
+
+func TestBodyTemplateSettings(t *testing.T) {
+	const secretARN = "arn:aws:secretsmanager:us-east-1:111122223333:secret:body-template"
+	mock, factory := golambda.NewSecretsManagerMock()
+	mock.Secrets[secretARN] = `{"github_token":"xxx","github_body_template":"{{ summary . }}"}`
+
+	event := golambda.Event{Origin: map[string]interface{}{"Records": []interface{}{map[string]string{"body": "{}"}}}}
+
+	t.Run("broken template file fails whole batch", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "body.tmpl")
+		require.NoError(t, ioutil.WriteFile(path, []byte("{{ if }}"), 0644))
+		_, err := main.Handler(main.Arguments{
+			SecretARN:    secretARN,
+			GitHubRepo:   "blue/orange",
+			BodyTmplFile: path,
+			NewSM:        factory,
+		}, event)
+		assert.Error(t, err)
+	})
+
+	t.Run("template in env var is prior to file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "body.tmpl")
+		require.NoError(t, ioutil.WriteFile(path, []byte("{{ if }}"), 0644))
+		_, err := main.Handler(main.Arguments{
+			SecretARN:    secretARN,
+			GitHubRepo:   "blue/orange",
+			BodyTemplate: "{{ systemInfo . }}",
+			BodyTmplFile: path,
+			NewSM:        factory,
+			DryRun:       true,
+		}, event)
+		assert.NoError(t, err)
+	})
+}
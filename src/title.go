@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/deepalert/deepalert"
+	"github.com/m-mizutani/golambda"
+)
+
+// maxTitleLength is limit of issue title length in GitHub
+const maxTitleLength = 256
+
+// defaultTitleTemplate is "[Detector] RuleName: Description" of the first
+// alert with number of other rules in the report.
+const defaultTitleTemplate = `[{{ .Alert.Detector }}] {{ .Alert.RuleName }}: {{ .Alert.Description }}` +
+	`{{ if .MoreRules }} (+{{ .MoreRules }} more){{ end }}`
+
+// titleTemplateData is passed to issue title template as "."
+type titleTemplateData struct {
+	Report     deepalert.Report
+	ID         deepalert.ReportID
+	Severity   deepalert.ReportSeverity
+	Alert      *deepalert.Alert
+	AlertCount int
+	// Detectors and Rules are distinct names in order of alerts
+	Detectors []string
+	Rules     []string
+	// MoreRules is number of distinct detector and rule pairs other than the
+	// first alert
+	MoreRules int
+	// Values are distinct attribute values of the report, or of alerts if
+	// the report has no attribute
+	Values []string
+}
+
+func newTitleTemplateData(report deepalert.Report) *titleTemplateData {
+	data := &titleTemplateData{
+		Report:     report,
+		ID:         report.ID,
+		Severity:   report.Result.Severity,
+		Alert:      &deepalert.Alert{},
+		AlertCount: len(report.Alerts),
+	}
+	if len(report.Alerts) > 0 {
+		data.Alert = report.Alerts[0]
+	}
+
+	pairs := map[string]struct{}{}
+	for _, alert := range report.Alerts {
+		data.Detectors = appendUniq(data.Detectors, alert.Detector)
+		data.Rules = appendUniq(data.Rules, alert.RuleName)
+		pairs[alert.Detector+"\x00"+alert.RuleName] = struct{}{}
+	}
+	if len(pairs) > 1 {
+		data.MoreRules = len(pairs) - 1
+	}
+
+	for _, attr := range report.Attributes {
+		data.Values = appendUniq(data.Values, attr.Value)
+	}
+	if len(data.Values) == 0 {
+		for _, alert := range report.Alerts {
+			for _, attr := range alert.Attributes {
+				data.Values = appendUniq(data.Values, attr.Value)
+			}
+		}
+	}
+
+	return data
+}
+
+var titleTemplateFuncs = template.FuncMap{
+	"join": strings.Join,
+	// first returns first n items
+	"first": func(n int, items []string) []string {
+		if len(items) < n {
+			return items
+		}
+		return items[:n]
+	},
+}
+
+func parseTitleTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = defaultTitleTemplate
+	}
+
+	tmpl, err := template.New("title").Funcs(titleTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, golambda.WrapError(err, "Failed to parse issue title template")
+	}
+	return tmpl, nil
+}
+
+// truncateTitle makes title one line within maxTitleLength runes
+func truncateTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	if r := []rune(title); len(r) > maxTitleLength {
+		title = string(r[:maxTitleLength-1]) + "…"
+	}
+	return title
+}
+
+func reportToTitle(report deepalert.Report, tmplText string) (string, error) {
+	tmpl, err := parseTitleTemplate(tmplText)
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, newTitleTemplateData(report)); err != nil {
+		return "", golambda.WrapError(err, "Failed to execute issue title template").With("reportID", report.ID)
+	}
+
+	return truncateTitle(buf.String()), nil
+}
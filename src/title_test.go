@@ -0,0 +1,68 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/deepalert/deepalert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/deepalert/deepalert-github/src"
+)
+
+func renderTitle(t *testing.T, report deepalert.Report, tmpl string) string {
+	raw, err := json.Marshal(report)
+	require.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	require.NoError(t, main.RenderCommand([]string{"-title", tmpl}, bytes.NewReader(raw), out))
+	lines := strings.Split(out.String(), "\n")
+	require.True(t, strings.HasSuffix(lines[0], "issue_title.txt <=="))
+	return lines[1]
+}
+
+func TestReportTitle(t *testing.T) {
+	t.Run("default title of single rule", func(t *testing.T) {
+		report := newAlertReport(2)
+		assert.Equal(t, "[blue] orange: alert 0", renderTitle(t, report, ""))
+	})
+
+	t.Run("default title of multiple rules", func(t *testing.T) {
+		report := newAlertReport(4)
+		report.Alerts[1].RuleName = "red"
+		report.Alerts[2].Detector = "green"
+		report.Alerts[3].RuleName = "red"
+		assert.Equal(t, "[blue] orange: alert 0 (+2 more)", renderTitle(t, report, ""))
+	})
+
+	t.Run("custom title", func(t *testing.T) {
+		report := newAlertReport(3)
+		report.Alerts[2].Detector = "green"
+		report.Result.Severity = deepalert.SevUrgent
+		report.Attributes = []*deepalert.Attribute{
+			{Type: deepalert.TypeIPAddr, Key: "src", Value: "10.0.0.1"},
+			{Type: deepalert.TypeDomainName, Key: "dst", Value: "example.com"},
+		}
+		tmpl := `[{{ .Severity }}] {{ join .Detectors "," }} {{ .AlertCount }} alerts: {{ join (first 1 .Values) "," }} ({{ .ID }})`
+		assert.Equal(t, "[urgent] blue,green 3 alerts: 10.0.0.1 ("+string(report.ID)+")", renderTitle(t, report, tmpl))
+	})
+
+	t.Run("truncate long title", func(t *testing.T) {
+		report := newAlertReport(1)
+		report.Alerts[0].Description = strings.Repeat("あ", 300) + "\nnext line"
+		title := renderTitle(t, report, "")
+		assert.Equal(t, 256, utf8.RuneCountInString(title))
+		assert.True(t, strings.HasSuffix(title, "…"))
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		raw, err := json.Marshal(newAlertReport(1))
+		require.NoError(t, err)
+		err = main.RenderCommand([]string{"-title", "{{ .NoSuchField }}"}, bytes.NewReader(raw), new(bytes.Buffer))
+		assert.Error(t, err)
+	})
+}